@@ -0,0 +1,186 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+const annotationPrefix = "secrets.aws.k8s/"
+
+// knownAnnotations are the secrets.aws.k8s/* annotations that are understood by the webhook.
+var knownAnnotations = []string{
+    "secrets.aws.k8s/injectorWebhook",
+    "secrets.aws.k8s/secretArns",
+    "secrets.aws.k8s/secretNames",
+    "secrets.aws.k8s/region",
+    "secrets.aws.k8s/explodeJsonKeys",
+    "secrets.aws.k8s/roleArn",
+    "secrets.aws.k8s/externalId",
+    "secrets.aws.k8s/secretRoles",
+}
+
+// SecretAnnotations holds the settings from a pod's secrets.aws.k8s/* annotations.
+type SecretAnnotations struct {
+    InjectorWebhook string
+    SecretArns []string
+    SecretNames []string
+    Region string
+    ExplodeJsonKeys *bool
+    RoleArn string
+    ExternalId string
+    SecretRoles map[string]SecretRole
+    Warnings []string
+}
+
+// parseSecretAnnotations parses and validates the secret injection annotations of a pod (or pod template).
+// InjectorWebhook is empty if the secrets.aws.k8s/injectorWebhook annotation is not set. Problems that do
+// not prevent injection are returned as warnings.
+func parseSecretAnnotations(annotations map[string]string) (*SecretAnnotations, error) {
+    secretAnnotations := SecretAnnotations{}
+    secretAnnotations.Warnings = append(secretAnnotations.Warnings, checkUnknownAnnotations(annotations)...)
+    injectorWebhook, ok := annotations["secrets.aws.k8s/injectorWebhook"]
+    if !ok {
+        for _, key := range sortedKeys(annotations) {
+            if containsString(knownAnnotations, key) {
+                secretAnnotations.Warnings = append(secretAnnotations.Warnings, fmt.Sprintf("Pod annotation secrets.aws.k8s/injectorWebhook is not set, so %s will be ignored", key))
+            }
+        }
+        return &secretAnnotations, nil
+    }
+    secretAnnotations.InjectorWebhook = injectorWebhook
+    if injectorWebhook != "init-container" {
+        secretAnnotations.Warnings = append(secretAnnotations.Warnings, fmt.Sprintf("Pod annotation secrets.aws.k8s/injectorWebhook has unsupported value %q (expected init-container), so no secrets will be injected", injectorWebhook))
+        return &secretAnnotations, nil
+    }
+
+    annotation_secret_arns, secretArnsSet := annotations["secrets.aws.k8s/secretArns"]
+    annotation_secret_names, secretNamesSet := annotations["secrets.aws.k8s/secretNames"]
+    if secretArnsSet && secretNamesSet {
+        return nil, fmt.Errorf("Only one of pod annotations secrets.aws.k8s/secretArns and secrets.aws.k8s/secretNames can be set")
+    }
+    if !secretArnsSet && !secretNamesSet {
+        return nil, fmt.Errorf("One of pod annotations secrets.aws.k8s/secretArns or secrets.aws.k8s/secretNames must be set")
+    }
+    secretAnnotations.Region = annotations["secrets.aws.k8s/region"]
+    if secretArnsSet {
+        if secretAnnotations.Region != "" {
+            secretAnnotations.Warnings = append(secretAnnotations.Warnings, "Pod annotation secrets.aws.k8s/secretArns is set, so secrets.aws.k8s/region will be ignored")
+        }
+        secretAnnotations.SecretArns = splitList(annotation_secret_arns)
+        for _, secretArn := range secretAnnotations.SecretArns {
+            if err := validateSecretArn(secretArn); err != nil {
+                return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretArns is invalid: %v", err)
+            }
+        }
+        secretAnnotations.Warnings = append(secretAnnotations.Warnings, checkList("secrets.aws.k8s/secretArns", annotation_secret_arns)...)
+    } else {
+        secretAnnotations.SecretNames = splitList(annotation_secret_names)
+        for _, secretName := range secretAnnotations.SecretNames {
+            if secretName == "" {
+                return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretNames is invalid: secret names cannot be empty")
+            }
+        }
+        secretAnnotations.Warnings = append(secretAnnotations.Warnings, checkList("secrets.aws.k8s/secretNames", annotation_secret_names)...)
+    }
+
+    if annotation_explode_json_keys, ok := annotations["secrets.aws.k8s/explodeJsonKeys"]; ok {
+        explodeJsonKeys, err := strconv.ParseBool(annotation_explode_json_keys)
+        if err != nil {
+            return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/explodeJsonKeys must be true or false, not %q", annotation_explode_json_keys)
+        }
+        secretAnnotations.ExplodeJsonKeys = &explodeJsonKeys
+        if annotation_explode_json_keys != "true" && annotation_explode_json_keys != "false" {
+            secretAnnotations.Warnings = append(secretAnnotations.Warnings, fmt.Sprintf("Pod annotation secrets.aws.k8s/explodeJsonKeys is set to %q, which is deprecated - use true or false", annotation_explode_json_keys))
+        }
+    }
+
+    secretAnnotations.RoleArn = annotations["secrets.aws.k8s/roleArn"]
+    secretAnnotations.ExternalId = annotations["secrets.aws.k8s/externalId"]
+    if secretAnnotations.ExternalId != "" && secretAnnotations.RoleArn == "" {
+        return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/externalId requires that annotation secrets.aws.k8s/roleArn is also set")
+    }
+    if secretAnnotations.RoleArn != "" {
+        if err := validateRoleArn(secretAnnotations.RoleArn); err != nil {
+            return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/roleArn is invalid: %v", err)
+        }
+    }
+    if annotation_secret_roles, ok := annotations["secrets.aws.k8s/secretRoles"]; ok {
+        secretRoles, err := parseSecretRoles(annotation_secret_roles, secretAnnotations.secrets())
+        if err != nil {
+            return nil, err
+        }
+        secretAnnotations.SecretRoles = secretRoles
+    }
+    return &secretAnnotations, nil
+}
+
+// secrets returns the secrets to be injected, as listed in the annotations.
+func (a *SecretAnnotations) secrets() []string {
+    if a.SecretArns != nil {
+        return a.SecretArns
+    }
+    return a.SecretNames
+}
+
+// checkUnknownAnnotations warns about secrets.aws.k8s/* annotations that are not understood, e.g. because of
+// a typo, suggesting the known annotation with the same name in a different case.
+func checkUnknownAnnotations(annotations map[string]string) []string {
+    var warnings []string
+    for _, key := range sortedKeys(annotations) {
+        if !strings.HasPrefix(key, annotationPrefix) || containsString(knownAnnotations, key) || containsString(statusAnnotationNames, key) {
+            continue
+        }
+        warning := fmt.Sprintf("Pod annotation %s is not recognised and will be ignored", key)
+        for _, known := range knownAnnotations {
+            if strings.EqualFold(known, key) {
+                warning = fmt.Sprintf("%s - did you mean %s?", warning, known)
+            }
+        }
+        warnings = append(warnings, warning)
+    }
+    return warnings
+}
+
+// checkList warns about entries of a comma-separated list that use deprecated syntax or are repeated.
+func checkList(annotation string, list string) []string {
+    var warnings []string
+    var seen []string
+    for _, value := range strings.Split(list, ",") {
+        if value != strings.TrimSpace(value) {
+            warnings = append(warnings, fmt.Sprintf("Pod annotation %s has spaces around %q - this is deprecated, please separate the values with commas only", annotation, strings.TrimSpace(value)))
+            value = strings.TrimSpace(value)
+        }
+        if containsString(seen, value) {
+            warnings = append(warnings, fmt.Sprintf("Pod annotation %s lists %q more than once", annotation, value))
+        }
+        seen = append(seen, value)
+    }
+    return warnings
+}
+
+func sortedKeys(values map[string]string) []string {
+    var keys []string
+    for key := range values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// ARN is an Amazon Resource Name, split into its components.
+type ARN struct {
+    Partition string
+    Service string
+    Region string
+    AccountID string
+    Resource string
+}
+
+var (
+    arnPartitions = []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b"}
+    arnRegionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+    arnAccountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+    /* resource types of the services that secrets can be retrieved from */
+    secretArnResourceTypes = map[string]string{
+        "secretsmanager": "secret",
+    }
+)
+
+// parseArn splits an ARN into its components, checking that the partition and account ID are valid.
+func parseArn(value string) (ARN, error) {
+    sections := strings.SplitN(value, ":", 6)
+    if len(sections) != 6 || sections[0] != "arn" {
+        return ARN{}, fmt.Errorf("%q is not an ARN", value)
+    }
+    parsed := ARN{
+        Partition: sections[1],
+        Service: sections[2],
+        Region: sections[3],
+        AccountID: sections[4],
+        Resource: sections[5],
+    }
+    if !containsString(arnPartitions, parsed.Partition) {
+        return parsed, fmt.Errorf("ARN %q has unknown partition %q (expected one of %s)", value, parsed.Partition, strings.Join(arnPartitions, ", "))
+    }
+    if !arnAccountIDPattern.MatchString(parsed.AccountID) {
+        return parsed, fmt.Errorf("ARN %q has invalid account ID %q (expected 12 digits)", value, parsed.AccountID)
+    }
+    return parsed, nil
+}
+
+// validateSecretArn checks that an ARN refers to a secret in a supported service.
+func validateSecretArn(value string) error {
+    parsed, err := parseArn(value)
+    if err != nil {
+        return err
+    }
+    resourceType, ok := secretArnResourceTypes[parsed.Service]
+    if !ok {
+        return fmt.Errorf("ARN %q has unsupported service %q (expected secretsmanager)", value, parsed.Service)
+    }
+    if !arnRegionPattern.MatchString(parsed.Region) {
+        return fmt.Errorf("ARN %q has invalid region %q", value, parsed.Region)
+    }
+    resource := strings.SplitN(parsed.Resource, ":", 2)
+    if resource[0] != resourceType {
+        return fmt.Errorf("ARN %q has unsupported resource type %q (expected %s)", value, resource[0], resourceType)
+    }
+    if len(resource) != 2 || resource[1] == "" {
+        return fmt.Errorf("ARN %q has no %s name", value, resourceType)
+    }
+    return nil
+}
+
+// validateRoleArn checks that an ARN refers to an IAM role.
+func validateRoleArn(value string) error {
+    parsed, err := parseArn(value)
+    if err != nil {
+        return err
+    }
+    if parsed.Service != "iam" {
+        return fmt.Errorf("ARN %q has unsupported service %q (expected iam)", value, parsed.Service)
+    }
+    if parsed.Region != "" {
+        return fmt.Errorf("ARN %q should not have a region", value)
+    }
+    if !strings.HasPrefix(parsed.Resource, "role/") || len(parsed.Resource) == len("role/") {
+        return fmt.Errorf("ARN %q is not an IAM role", value)
+    }
+    return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestParseArn(t *testing.T) {
+    tests := []struct {
+        value string
+        expected ARN
+        err string
+    }{
+        {value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF",
+            expected: ARN{Partition: "aws", Service: "secretsmanager", Region: "us-east-1", AccountID: "123456789012", Resource: "secret:db-hlRvvF"}},
+        {value: "arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:db",
+            expected: ARN{Partition: "aws-cn", Service: "secretsmanager", Region: "cn-north-1", AccountID: "123456789012", Resource: "secret:db"}},
+        {value: "arn:aws-us-gov:iam::123456789012:role/path/app",
+            expected: ARN{Partition: "aws-us-gov", Service: "iam", AccountID: "123456789012", Resource: "role/path/app"}},
+        {value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:team/db:with:colons",
+            expected: ARN{Partition: "aws", Service: "secretsmanager", Region: "us-east-1", AccountID: "123456789012", Resource: "secret:team/db:with:colons"}},
+        {value: "db", err: `"db" is not an ARN`},
+        {value: "arn:aws:secretsmanager:us-east-1:123456789012", err: "is not an ARN"},
+        {value: "urn:aws:secretsmanager:us-east-1:123456789012:secret:db", err: "is not an ARN"},
+        {value: "arn:amazon:secretsmanager:us-east-1:123456789012:secret:db", err: `unknown partition "amazon"`},
+        {value: "arn:aws:secretsmanager:us-east-1:1234:secret:db", err: `invalid account ID "1234"`},
+        {value: "arn:aws:secretsmanager:us-east-1::secret:db", err: `invalid account ID ""`},
+    }
+    for _, test := range tests {
+        parsed, err := parseArn(test.value)
+        if test.err != "" {
+            if err == nil || !strings.Contains(err.Error(), test.err) {
+                t.Errorf("%s: expected an error containing %q, got %v", test.value, test.err, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: unexpected error: %v", test.value, err)
+        } else if parsed != test.expected {
+            t.Errorf("%s: expected %+v, got %+v", test.value, test.expected, parsed)
+        }
+    }
+}
+
+func TestValidateSecretArn(t *testing.T) {
+    tests := map[string]string{
+        "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF": "",
+        "arn:aws-iso-b:secretsmanager:us-isob-east-1:123456789012:secret:db": "",
+        "arn:aws:secretsmanager:eu-central-2:123456789012:secret:team-a/db": "",
+        "arn:aws:ssm:us-east-1:123456789012:parameter/db": `unsupported service "ssm"`,
+        "arn:aws:secretsmanager::123456789012:secret:db": `invalid region ""`,
+        "arn:aws:secretsmanager:useast1:123456789012:secret:db": `invalid region "useast1"`,
+        "arn:aws:secretsmanager:US-EAST-1:123456789012:secret:db": `invalid region "US-EAST-1"`,
+        "arn:aws:secretsmanager:us-east-1:123456789012:parameter:db": `unsupported resource type "parameter"`,
+        "arn:aws:secretsmanager:us-east-1:123456789012:secret": "has no secret name",
+        "arn:aws:secretsmanager:us-east-1:123456789012:secret:": "has no secret name",
+    }
+    for value, expected := range tests {
+        err := validateSecretArn(value)
+        if expected == "" && err != nil {
+            t.Errorf("%s: unexpected error: %v", value, err)
+        } else if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+            t.Errorf("%s: expected an error containing %q, got %v", value, expected, err)
+        }
+    }
+}
+
+func TestValidateRoleArn(t *testing.T) {
+    tests := map[string]string{
+        "arn:aws:iam::123456789012:role/app": "",
+        "arn:aws:iam::123456789012:role/path/to/app": "",
+        "arn:aws-cn:iam::123456789012:role/app": "",
+        "arn:aws:sts::123456789012:assumed-role/app/session": `unsupported service "sts"`,
+        "arn:aws:iam:us-east-1:123456789012:role/app": "should not have a region",
+        "arn:aws:iam::123456789012:user/app": "is not an IAM role",
+        "arn:aws:iam::123456789012:role/": "is not an IAM role",
+        "arn:aws:iam::12345678901x:role/app": "invalid account ID",
+    }
+    for value, expected := range tests {
+        err := validateRoleArn(value)
+        if expected == "" && err != nil {
+            t.Errorf("%s: unexpected error: %v", value, err)
+        } else if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+            t.Errorf("%s: expected an error containing %q, got %v", value, expected, err)
+        }
+    }
+}
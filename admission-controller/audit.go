@@ -0,0 +1,175 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+
+    admission "k8s.io/api/admission/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/klog/v2"
+)
+
+// auditSchemaVersion identifies the schema of the audit events. Fields may be added, but are never removed or
+// changed without a new version.
+const auditSchemaVersion = "aws-secret-injector.audit/v1"
+
+// AuditEvent records an admission decision: who created which pod (or workload), the secrets it requested and
+// whether they were granted. It contains secret references (ARNs and names) but never secret values.
+type AuditEvent struct {
+    SchemaVersion string `json:"schemaVersion"`
+    Time time.Time `json:"time"`
+    Webhook string `json:"webhook"`
+    RequestUID types.UID `json:"requestUID"`
+    Operation admission.Operation `json:"operation"`
+    DryRun bool `json:"dryRun"`
+    User AuditUser `json:"user"`
+    Kind string `json:"kind"`
+    Namespace string `json:"namespace"`
+    Name string `json:"name"`
+    ServiceAccount string `json:"serviceAccount"`
+    Outcome string `json:"outcome"`
+    Reason string `json:"reason"`
+    Message string `json:"message"`
+    InjectorWebhook string `json:"injectorWebhook"`
+    SecretArns []string `json:"secretArns"`
+    SecretNames []string `json:"secretNames"`
+    Region string `json:"region"`
+    CredentialMechanism string `json:"credentialMechanism"`
+    PolicyDecision PolicyDecision `json:"policyDecision"`
+    Warnings []string `json:"warnings"`
+    PatchSHA256 string `json:"patchSHA256"`
+    /* which check each warning comes from, e.g. warnedRegion; not written to the audit log */
+    warningReasons map[string]string
+}
+
+// AuditUser is the user that made the request, from the AdmissionRequest's UserInfo.
+type AuditUser struct {
+    Username string `json:"username"`
+    UID string `json:"uid"`
+    Groups []string `json:"groups"`
+}
+
+// AuditSink writes audit events as JSON lines to a file or stdout.
+type AuditSink struct {
+    mutex sync.Mutex
+    out io.Writer
+    file *os.File
+}
+
+var (
+    auditSink *AuditSink
+)
+
+// newAuditSink opens the audit log, appending to it if it is a file that already exists. "-" is stdout.
+func newAuditSink(path string) (*AuditSink, error) {
+    if path == "-" {
+        return &AuditSink{out: os.Stdout}, nil
+    }
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+    if err != nil {
+        return nil, fmt.Errorf("Unable to open audit log %s: %v", path, err)
+    }
+    return &AuditSink{out: file, file: file}, nil
+}
+
+// newAuditEvent starts an audit event for a request. The rest of the event is filled in as the request is handled.
+func newAuditEvent(webhook string, request *admission.AdmissionRequest) *AuditEvent {
+    event := &AuditEvent{
+        SchemaVersion: auditSchemaVersion,
+        Webhook: webhook,
+        RequestUID: request.UID,
+        Operation: request.Operation,
+        User: AuditUser{
+            Username: request.UserInfo.Username,
+            UID: request.UserInfo.UID,
+            Groups: request.UserInfo.Groups,
+        },
+        Kind: request.Kind.Kind,
+        Namespace: request.Namespace,
+        Name: request.Name,
+        PolicyDecision: PolicyDecision{Policy: decisionNotEvaluated, Rules: decisionNotEvaluated},
+    }
+    if request.DryRun != nil {
+        event.DryRun = *request.DryRun
+    }
+    return event
+}
+
+// setSecrets records the secrets requested in the annotations.
+func (e *AuditEvent) setSecrets(secretAnnotations *SecretAnnotations) {
+    e.InjectorWebhook = secretAnnotations.InjectorWebhook
+    e.SecretArns = secretAnnotations.SecretArns
+    e.SecretNames = secretAnnotations.SecretNames
+}
+
+// addWarningReason records which check a warning comes from.
+func (e *AuditEvent) addWarningReason(warning string, reason string) {
+    if e.warningReasons == nil {
+        e.warningReasons = map[string]string{}
+    }
+    e.warningReasons[warning] = reason
+}
+
+// complete fills in the outcome of the request from the response.
+func (e *AuditEvent) complete(response *admission.AdmissionResponse, reason string) {
+    e.Time = time.Now().UTC()
+    e.Outcome, e.Reason = admissionOutcome(response, reason)
+    if response.Result != nil {
+        e.Message = response.Result.Message
+    }
+    e.Warnings = response.Warnings
+    if len(response.Patch) > 0 {
+        hash := sha256.Sum256(response.Patch)
+        e.PatchSHA256 = hex.EncodeToString(hash[:])
+    }
+}
+
+// record writes a completed event to the audit log, if there is one.
+func (s *AuditSink) record(event *AuditEvent) {
+    if s == nil {
+        return
+    }
+    if err := s.write(event); err != nil {
+        klog.ErrorS(err, "Unable to write audit event", "uid", event.RequestUID, "namespace", event.Namespace)
+    }
+}
+
+// write appends an event to the audit log as a single line. Events written to a file are synced to disk, so
+// that they are not lost if the pod is killed.
+func (s *AuditSink) write(event *AuditEvent) error {
+    line, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if _, err := s.out.Write(append(line, '\n')); err != nil {
+        return err
+    }
+    if s.file != nil {
+        return s.file.Sync()
+    }
+    return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+// withAuditLog records audit events in a buffer while a test runs.
+func withAuditLog(t *testing.T) *bytes.Buffer {
+    t.Helper()
+    var out bytes.Buffer
+    auditSink = &AuditSink{out: &out}
+    t.Cleanup(func() { auditSink = nil })
+    return &out
+}
+
+func decodeAuditEvents(t *testing.T, out *bytes.Buffer) []AuditEvent {
+    t.Helper()
+    var events []AuditEvent
+    for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+        event := AuditEvent{}
+        if err := json.Unmarshal([]byte(line), &event); err != nil {
+            t.Fatalf("audit log line is not an audit event: %v: %s", err, line)
+        }
+        events = append(events, event)
+    }
+    return events
+}
+
+func TestAuditMutatedPod(t *testing.T) {
+    withCluster(t)
+    out := withAuditLog(t)
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request.json")))
+    events := decodeAuditEvents(t, out)
+    if len(events) != 1 {
+        t.Fatalf("expected 1 audit event, got %d", len(events))
+    }
+    event := events[0]
+    if event.SchemaVersion != auditSchemaVersion || event.Webhook != "mutating-pods" || event.RequestUID != response.UID {
+        t.Errorf("unexpected audit event %+v", event)
+    }
+    if event.User.Username != "admin" || event.Namespace != "my-namespace" || event.Name != "my-pod" {
+        t.Errorf("expected the user, namespace and pod to be recorded, got %+v", event)
+    }
+    if event.Outcome != "mutated" || len(event.SecretArns) != 1 || event.PolicyDecision.Policy != decisionDisabled {
+        t.Errorf("expected the granted secret and policy decision to be recorded, got %+v", event)
+    }
+    hash := sha256.Sum256(response.Patch)
+    if event.PatchSHA256 != hex.EncodeToString(hash[:]) {
+        t.Errorf("expected the patch hash %x, got %s", hash, event.PatchSHA256)
+    }
+}
+
+func TestAuditDeniedPod(t *testing.T) {
+    out := withAuditLog(t)
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request-b.json")))
+    if response.Allowed {
+        t.Fatal("expected request to be denied")
+    }
+    events := decodeAuditEvents(t, out)
+    if len(events) != 1 || events[0].Outcome != "denied" || events[0].Reason != deniedInvalidAnnotations || events[0].Message != response.Result.Message {
+        t.Errorf("expected the denial to be recorded, got %+v", events)
+    }
+    if events[0].PatchSHA256 != "" {
+        t.Errorf("expected no patch hash for a denied pod, got %s", events[0].PatchSHA256)
+    }
+}
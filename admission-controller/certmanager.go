@@ -0,0 +1,470 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "fmt"
+    "io/ioutil"
+    "math/big"
+    "os"
+    "strings"
+    "time"
+
+    admissionregistration "k8s.io/api/admissionregistration/v1"
+    core "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/wait"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/leaderelection"
+    "k8s.io/client-go/tools/leaderelection/resourcelock"
+    "k8s.io/klog/v2"
+)
+
+const (
+    caValidity = 2 * 365 * 24 * time.Hour
+    servingCertValidity = 90 * 24 * time.Hour
+    /* how often the replica holding the lease checks the certificates and webhook configurations */
+    certReconcileInterval = time.Minute
+    /* how often every replica checks the Secret for a new serving certificate */
+    certSyncInterval = 10 * time.Second
+    secretCACertKey = "ca.crt"
+    secretCAKeyKey = "ca.key"
+    serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// CertManager generates the webhook's CA and serving certificate and stores them in a Secret that is shared
+// by all the replicas, rotating them before they expire. The caBundle of the webhook configurations is kept
+// up to date with the CA. Only the replica holding the lease changes anything, but every replica serves the
+// certificate from the Secret.
+type CertManager struct {
+    client kubernetes.Interface
+    namespace string
+    secretName string
+    serviceName string
+    webhookName string
+    watcher *CertWatcher
+    certPEM []byte
+    keyPEM []byte
+    /* the current time, replaced in tests */
+    now func() time.Time
+}
+
+// newCertManager creates a CertManager that stores the certificates in the given Secret and passes the
+// serving certificate to the watcher.
+func newCertManager(client kubernetes.Interface, namespace string, secretName string, serviceName string, webhookName string, watcher *CertWatcher) *CertManager {
+    return &CertManager{
+        client: client,
+        namespace: namespace,
+        secretName: secretName,
+        serviceName: serviceName,
+        webhookName: webhookName,
+        watcher: watcher,
+        now: time.Now,
+    }
+}
+
+// currentNamespace returns the namespace the admission controller is running in.
+func currentNamespace() (string, error) {
+    data, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+    if err != nil {
+        return "", fmt.Errorf("Unable to determine the current namespace: %v", err)
+    }
+    return strings.TrimSpace(string(data)), nil
+}
+
+// run keeps the serving certificate up to date from the Secret, and competes for the lease that allows a
+// replica to create and rotate the certificates. It returns when ctx is cancelled.
+func (m *CertManager) run(ctx context.Context) {
+    go wait.UntilWithContext(ctx, m.sync, certSyncInterval)
+
+    identity, err := os.Hostname()
+    if err != nil {
+        klog.Fatal("Unable to determine the hostname for the certificate lease: ", err)
+    }
+    lock := &resourcelock.LeaseLock{
+        LeaseMeta: meta.ObjectMeta{Namespace: m.namespace, Name: m.secretName},
+        Client: m.client.CoordinationV1(),
+        LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+    }
+    for ctx.Err() == nil {
+        leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+            Lock: lock,
+            ReleaseOnCancel: true,
+            LeaseDuration: 30 * time.Second,
+            RenewDeadline: 20 * time.Second,
+            RetryPeriod: 5 * time.Second,
+            Name: m.secretName,
+            Callbacks: leaderelection.LeaderCallbacks{
+                OnStartedLeading: func(ctx context.Context) {
+                    klog.Info("Acquired the certificate lease ", m.namespace, "/", m.secretName, ", managing certificates")
+                    wait.UntilWithContext(ctx, m.reconcile, certReconcileInterval)
+                },
+                OnStoppedLeading: func() {
+                    klog.Info("Released the certificate lease ", m.namespace, "/", m.secretName)
+                },
+            },
+        })
+    }
+}
+
+// sync loads the serving certificate from the Secret if the Secret has changed.
+func (m *CertManager) sync(ctx context.Context) {
+    secret, err := m.client.CoreV1().Secrets(m.namespace).Get(ctx, m.secretName, meta.GetOptions{})
+    if errors.IsNotFound(err) {
+        klog.Info("Waiting for the certificate secret ", m.namespace, "/", m.secretName, " to be created")
+        return
+    }
+    if err != nil {
+        klog.Error("Unable to read the certificate secret ", m.namespace, "/", m.secretName, ": ", err)
+        return
+    }
+    m.load(secret)
+}
+
+// load passes the serving certificate in the Secret to the watcher, unless it has already been loaded.
+func (m *CertManager) load(secret *core.Secret) {
+    certPEM, keyPEM := secret.Data[core.TLSCertKey], secret.Data[core.TLSPrivateKeyKey]
+    if bytes.Equal(certPEM, m.certPEM) && bytes.Equal(keyPEM, m.keyPEM) {
+        return
+    }
+    source := fmt.Sprintf("secret %s/%s", m.namespace, m.secretName)
+    if err := m.watcher.set(certPEM, keyPEM, source); err != nil {
+        klog.Error(err)
+        return
+    }
+    m.certPEM, m.keyPEM = certPEM, keyPEM
+}
+
+// reconcile makes sure the webhook configurations trust the CAs in the Secret, creates or rotates the
+// certificates as needed, then updates the webhook configurations again if the CA changed. The new serving
+// certificate is picked up by sync, like on the other replicas. Errors are logged and the next attempt is made
+// on the next interval.
+func (m *CertManager) reconcile(ctx context.Context) {
+    secrets := m.client.CoreV1().Secrets(m.namespace)
+    secret, err := secrets.Get(ctx, m.secretName, meta.GetOptions{})
+    exists := true
+    if errors.IsNotFound(err) {
+        secret = &core.Secret{
+            ObjectMeta: meta.ObjectMeta{Name: m.secretName, Namespace: m.namespace},
+            Type: core.SecretTypeTLS,
+        }
+        exists = false
+    } else if err != nil {
+        klog.Error("Unable to read the certificate secret ", m.namespace, "/", m.secretName, ": ", err)
+        return
+    }
+
+    /* a serving certificate is only issued by a new CA once the webhooks trust it */
+    trusted := exists
+    if exists {
+        if err := m.updateWebhookConfigurations(ctx, secret.Data[secretCACertKey]); err != nil {
+            klog.Error(err)
+            trusted = false
+        }
+    }
+    data, changed, err := m.renew(secret.Data, trusted, m.now())
+    if err != nil {
+        klog.Error("Unable to generate certificates: ", err)
+        return
+    }
+    if changed {
+        secret.Data = data
+        if exists {
+            secret, err = secrets.Update(ctx, secret, meta.UpdateOptions{})
+        } else {
+            secret, err = secrets.Create(ctx, secret, meta.CreateOptions{})
+        }
+        if err != nil {
+            klog.Error("Unable to store the certificates in secret ", m.namespace, "/", m.secretName, ": ", err)
+            return
+        }
+        klog.Info("Stored new certificates in secret ", m.namespace, "/", m.secretName)
+        if err := m.updateWebhookConfigurations(ctx, secret.Data[secretCACertKey]); err != nil {
+            klog.Error(err)
+        }
+    }
+}
+
+// renew returns the Secret data with a new CA and/or serving certificate if the current ones are missing,
+// invalid or past half of their lifetime, and whether anything was changed. When the CA is rotated, the
+// previous CA stays in ca.crt until it expires, so that the API server trusts the serving certificates of
+// replicas that have not loaded the new one yet. Unless there is no usable serving certificate, a new one is
+// only issued by a CA that the webhook configurations already trust (trusted), so a new CA is used from the
+// next reconcile, after the caBundle has been updated.
+func (m *CertManager) renew(data map[string][]byte, trusted bool, now time.Time) (map[string][]byte, bool, error) {
+    changed := false
+    rotated := false
+    caCerts := parseCertificates(data[secretCACertKey], now)
+    caKey, err := parsePrivateKey(data[secretCAKeyKey])
+    if err != nil || len(caCerts) == 0 || needsRenewal(caCerts[0], caValidity, now) || !matchesKey(caCerts[0], caKey) {
+        caCert, key, err := generateCA(now)
+        if err != nil {
+            return nil, false, err
+        }
+        klog.Info("Generated a new CA certificate expiring ", caCert.NotAfter.Format(time.RFC3339))
+        caCerts = append([]*x509.Certificate{caCert}, caCerts...)
+        caKey = key
+        changed, rotated = true, true
+    }
+
+    dnsNames := m.dnsNames()
+    servingCerts := parseCertificates(data[core.TLSCertKey], now)
+    servingKey, err := parsePrivateKey(data[core.TLSPrivateKeyKey])
+    usable := err == nil && len(servingCerts) > 0 && matchesKey(servingCerts[0], servingKey) && verifiesAny(servingCerts[0], caCerts, dnsNames[0], now)
+    issue := !usable
+    if usable && (needsRenewal(servingCerts[0], servingCertValidity, now) || !verifies(servingCerts[0], caCerts[0], dnsNames[0], now)) {
+        if rotated || !trusted {
+            klog.Info("Keeping the current serving certificate until the webhook configurations are known to trust the CA")
+        } else {
+            issue = true
+        }
+    }
+    if issue {
+        servingCert, key, err := generateServingCert(caCerts[0], caKey, dnsNames, now)
+        if err != nil {
+            return nil, false, err
+        }
+        klog.Info("Generated a new serving certificate for ", dnsNames[0], " expiring ", servingCert.NotAfter.Format(time.RFC3339))
+        servingCerts = []*x509.Certificate{servingCert}
+        servingKey = key
+        changed = true
+    }
+    if !changed {
+        return data, false, nil
+    }
+
+    caKeyPEM, err := encodePrivateKey(caKey)
+    if err != nil {
+        return nil, false, err
+    }
+    servingKeyPEM, err := encodePrivateKey(servingKey)
+    if err != nil {
+        return nil, false, err
+    }
+    return map[string][]byte{
+        secretCACertKey: encodeCertificates(caCerts),
+        secretCAKeyKey: caKeyPEM,
+        core.TLSCertKey: encodeCertificates(servingCerts),
+        core.TLSPrivateKeyKey: servingKeyPEM,
+    }, true, nil
+}
+
+// dnsNames returns the names the webhook service can be reached by, the first being the one the API server uses.
+func (m *CertManager) dnsNames() []string {
+    return []string{
+        fmt.Sprintf("%s.%s.svc", m.serviceName, m.namespace),
+        fmt.Sprintf("%s.%s.svc.cluster.local", m.serviceName, m.namespace),
+        fmt.Sprintf("%s.%s", m.serviceName, m.namespace),
+        m.serviceName,
+    }
+}
+
+// updateWebhookConfigurations sets the caBundle of the webhooks that call the admission controller's service.
+// The validating webhook configuration is optional.
+func (m *CertManager) updateWebhookConfigurations(ctx context.Context, caBundle []byte) error {
+    webhooks := m.client.AdmissionregistrationV1()
+    mutating, err := webhooks.MutatingWebhookConfigurations().Get(ctx, m.webhookName, meta.GetOptions{})
+    if err != nil {
+        return fmt.Errorf("Unable to read mutating webhook configuration %s: %v", m.webhookName, err)
+    }
+    changed := false
+    for i := range mutating.Webhooks {
+        changed = m.setCABundle(&mutating.Webhooks[i].ClientConfig, caBundle) || changed
+    }
+    if changed {
+        if _, err := webhooks.MutatingWebhookConfigurations().Update(ctx, mutating, meta.UpdateOptions{}); err != nil {
+            return fmt.Errorf("Unable to update the caBundle of mutating webhook configuration %s: %v", m.webhookName, err)
+        }
+        klog.Info("Updated the caBundle of mutating webhook configuration ", m.webhookName)
+    }
+
+    validating, err := webhooks.ValidatingWebhookConfigurations().Get(ctx, m.webhookName, meta.GetOptions{})
+    if errors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("Unable to read validating webhook configuration %s: %v", m.webhookName, err)
+    }
+    changed = false
+    for i := range validating.Webhooks {
+        changed = m.setCABundle(&validating.Webhooks[i].ClientConfig, caBundle) || changed
+    }
+    if changed {
+        if _, err := webhooks.ValidatingWebhookConfigurations().Update(ctx, validating, meta.UpdateOptions{}); err != nil {
+            return fmt.Errorf("Unable to update the caBundle of validating webhook configuration %s: %v", m.webhookName, err)
+        }
+        klog.Info("Updated the caBundle of validating webhook configuration ", m.webhookName)
+    }
+    return nil
+}
+
+// setCABundle updates the caBundle of a webhook if it calls the admission controller's service, returning
+// whether it was changed.
+func (m *CertManager) setCABundle(clientConfig *admissionregistration.WebhookClientConfig, caBundle []byte) bool {
+    service := clientConfig.Service
+    if service == nil || service.Name != m.serviceName || service.Namespace != m.namespace {
+        return false
+    }
+    if bytes.Equal(clientConfig.CABundle, caBundle) {
+        return false
+    }
+    clientConfig.CABundle = caBundle
+    return true
+}
+
+// needsRenewal checks whether a certificate is past half of its lifetime.
+func needsRenewal(cert *x509.Certificate, validity time.Duration, now time.Time) bool {
+    return cert.NotAfter.Sub(now) < validity/2
+}
+
+// verifies checks that a serving certificate was issued by the CA for the given name.
+func verifies(cert *x509.Certificate, caCert *x509.Certificate, dnsName string, now time.Time) bool {
+    roots := x509.NewCertPool()
+    roots.AddCert(caCert)
+    _, err := cert.Verify(x509.VerifyOptions{
+        DNSName: dnsName,
+        Roots: roots,
+        CurrentTime: now,
+        KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    })
+    return err == nil
+}
+
+// verifiesAny checks that a serving certificate was issued by one of the CAs for the given name.
+func verifiesAny(cert *x509.Certificate, caCerts []*x509.Certificate, dnsName string, now time.Time) bool {
+    for _, caCert := range caCerts {
+        if verifies(cert, caCert, dnsName, now) {
+            return true
+        }
+    }
+    return false
+}
+
+// matchesKey checks that a certificate is for the given private key.
+func matchesKey(cert *x509.Certificate, key *ecdsa.PrivateKey) bool {
+    if key == nil {
+        return false
+    }
+    public, ok := cert.PublicKey.(*ecdsa.PublicKey)
+    return ok && public.Equal(&key.PublicKey)
+}
+
+// generateCA creates a self-signed CA certificate.
+func generateCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+    template := x509.Certificate{
+        Subject: pkix.Name{CommonName: fmt.Sprintf("aws-secret-injector-ca@%d", now.Unix())},
+        NotBefore: now.Add(-time.Hour),
+        NotAfter: now.Add(caValidity),
+        KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageCRLSign,
+        BasicConstraintsValid: true,
+        IsCA: true,
+    }
+    return generateCertificate(&template, nil, nil)
+}
+
+// generateServingCert creates a serving certificate for the given names, issued by the CA.
+func generateServingCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, dnsNames []string, now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+    notAfter := now.Add(servingCertValidity)
+    if notAfter.After(caCert.NotAfter) {
+        notAfter = caCert.NotAfter
+    }
+    template := x509.Certificate{
+        Subject: pkix.Name{CommonName: dnsNames[0]},
+        DNSNames: dnsNames,
+        NotBefore: now.Add(-time.Hour),
+        NotAfter: notAfter,
+        KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        BasicConstraintsValid: true,
+    }
+    return generateCertificate(&template, caCert, caKey)
+}
+
+// generateCertificate creates a key and a certificate from the template, signed by the parent or self-signed
+// if there is no parent.
+func generateCertificate(template *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, nil, err
+    }
+    template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+    if err != nil {
+        return nil, nil, err
+    }
+    if parent == nil {
+        parent, parentKey = template, key
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+    if err != nil {
+        return nil, nil, err
+    }
+    cert, err := x509.ParseCertificate(der)
+    return cert, key, err
+}
+
+// parseCertificates returns the certificates in PEM data that have not expired, ignoring anything invalid.
+func parseCertificates(data []byte, now time.Time) []*x509.Certificate {
+    var certs []*x509.Certificate
+    for {
+        var block *pem.Block
+        block, data = pem.Decode(data)
+        if block == nil {
+            return certs
+        }
+        if block.Type != "CERTIFICATE" {
+            continue
+        }
+        cert, err := x509.ParseCertificate(block.Bytes)
+        if err == nil && now.Before(cert.NotAfter) {
+            certs = append(certs, cert)
+        }
+    }
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+    var data []byte
+    for _, cert := range certs {
+        data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+    }
+    return data
+}
+
+func parsePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("no PEM data found")
+    }
+    return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func encodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+    der, err := x509.MarshalECPrivateKey(key)
+    if err != nil {
+        return nil, err
+    }
+    return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/x509"
+    "testing"
+    "time"
+
+    admissionregistration "k8s.io/api/admissionregistration/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+var certManagerStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// webhookClientConfig returns a client config that calls the given service.
+func webhookClientConfig(namespace string, name string) admissionregistration.WebhookClientConfig {
+    return admissionregistration.WebhookClientConfig{Service: &admissionregistration.ServiceReference{Namespace: namespace, Name: name}}
+}
+
+// newTestCertManager creates a CertManager for the injector service with a fake clientset holding the given
+// objects, and a clock that tests can move forward.
+func newTestCertManager(t *testing.T, objects ...runtime.Object) (*CertManager, *fake.Clientset, *time.Time) {
+    t.Helper()
+    client := fake.NewSimpleClientset(objects...)
+    watcher, err := newCertWatcher("", "", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    now := certManagerStart
+    manager := newCertManager(client, "injector", "aws-secret-injector-tls", "aws-secret-injector", "aws-secret-injector", watcher)
+    manager.now = func() time.Time { return now }
+    return manager, client, &now
+}
+
+// webhookConfigurations returns a mutating and a validating webhook configuration, each with a webhook that
+// calls the injector service and one that calls another service.
+func webhookConfigurations() []runtime.Object {
+    return []runtime.Object{
+        &admissionregistration.MutatingWebhookConfiguration{
+            ObjectMeta: meta.ObjectMeta{Name: "aws-secret-injector"},
+            Webhooks: []admissionregistration.MutatingWebhook{
+                {Name: "pods.secrets.aws.k8s", ClientConfig: webhookClientConfig("injector", "aws-secret-injector")},
+                {Name: "other.example.com", ClientConfig: webhookClientConfig("other", "aws-secret-injector")},
+            },
+        },
+        &admissionregistration.ValidatingWebhookConfiguration{
+            ObjectMeta: meta.ObjectMeta{Name: "aws-secret-injector"},
+            Webhooks: []admissionregistration.ValidatingWebhook{
+                {Name: "workloads.secrets.aws.k8s", ClientConfig: webhookClientConfig("injector", "aws-secret-injector")},
+                {Name: "other.example.com", ClientConfig: webhookClientConfig("injector", "other")},
+            },
+        },
+    }
+}
+
+func getCertSecret(t *testing.T, client *fake.Clientset) map[string][]byte {
+    t.Helper()
+    secret, err := client.CoreV1().Secrets("injector").Get(context.TODO(), "aws-secret-injector-tls", meta.GetOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return secret.Data
+}
+
+// checkWebhookCABundles checks that the webhooks calling the injector service trust caBundle, and that the
+// other webhooks were left alone.
+func checkWebhookCABundles(t *testing.T, client *fake.Clientset, caBundle []byte) {
+    t.Helper()
+    webhooks := client.AdmissionregistrationV1()
+    mutating, err := webhooks.MutatingWebhookConfigurations().Get(context.TODO(), "aws-secret-injector", meta.GetOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    validating, err := webhooks.ValidatingWebhookConfigurations().Get(context.TODO(), "aws-secret-injector", meta.GetOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(mutating.Webhooks[0].ClientConfig.CABundle, caBundle) || !bytes.Equal(validating.Webhooks[0].ClientConfig.CABundle, caBundle) {
+        t.Error("expected the caBundle of the webhooks to be the CA certificates in the secret")
+    }
+    if len(mutating.Webhooks[1].ClientConfig.CABundle) > 0 || len(validating.Webhooks[1].ClientConfig.CABundle) > 0 {
+        t.Error("expected the caBundle of webhooks calling other services not to be set")
+    }
+}
+
+// checkServingCert checks that the serving certificate in the secret is issued by the first CA and returns both.
+func checkServingCert(t *testing.T, data map[string][]byte, now time.Time) (*x509.Certificate, []*x509.Certificate) {
+    t.Helper()
+    caCerts := parseCertificates(data[secretCACertKey], now)
+    servingCerts := parseCertificates(data[core.TLSCertKey], now)
+    if len(caCerts) == 0 || len(servingCerts) != 1 {
+        t.Fatalf("expected CA and serving certificates, got %d and %d", len(caCerts), len(servingCerts))
+    }
+    if !verifies(servingCerts[0], caCerts[0], "aws-secret-injector.injector.svc", now) {
+        t.Error("expected the serving certificate to be issued by the CA for the service")
+    }
+    return servingCerts[0], caCerts
+}
+
+func countUpdates(client *fake.Clientset, resource string) int {
+    count := 0
+    for _, action := range client.Actions() {
+        if (action.GetVerb() == "create" || action.GetVerb() == "update") && action.GetResource().Resource == resource {
+            count++
+        }
+    }
+    return count
+}
+
+func TestCertManagerCreatesCertificates(t *testing.T) {
+    manager, client, _ := newTestCertManager(t, webhookConfigurations()...)
+    manager.reconcile(context.TODO())
+
+    data := getCertSecret(t, client)
+    servingCert, caCerts := checkServingCert(t, data, certManagerStart)
+    if len(caCerts) != 1 || !servingCert.NotAfter.Equal(certManagerStart.Add(servingCertValidity).Truncate(time.Second)) {
+        t.Errorf("expected a single CA and a serving certificate valid for %v, got %d CAs and one expiring %v", servingCertValidity, len(caCerts), servingCert.NotAfter)
+    }
+    checkWebhookCABundles(t, client, data[secretCACertKey])
+
+    /* nothing changes until the certificates need renewing */
+    client.ClearActions()
+    manager.reconcile(context.TODO())
+    for _, resource := range []string{"secrets", "mutatingwebhookconfigurations", "validatingwebhookconfigurations"} {
+        if count := countUpdates(client, resource); count > 0 {
+            t.Errorf("expected %s not to be updated, got %d updates", resource, count)
+        }
+    }
+}
+
+func TestCertManagerRenewsServingCert(t *testing.T) {
+    manager, client, now := newTestCertManager(t, webhookConfigurations()...)
+    manager.reconcile(context.TODO())
+    before := getCertSecret(t, client)
+
+    *now = certManagerStart.Add(servingCertValidity/2 - time.Hour)
+    manager.reconcile(context.TODO())
+    if data := getCertSecret(t, client); !bytes.Equal(data[core.TLSCertKey], before[core.TLSCertKey]) {
+        t.Error("expected the serving certificate not to be renewed before half of its lifetime")
+    }
+
+    *now = certManagerStart.Add(servingCertValidity/2 + time.Hour)
+    manager.reconcile(context.TODO())
+    data := getCertSecret(t, client)
+    if bytes.Equal(data[core.TLSCertKey], before[core.TLSCertKey]) || bytes.Equal(data[core.TLSPrivateKeyKey], before[core.TLSPrivateKeyKey]) {
+        t.Error("expected the serving certificate and key to be renewed after half of their lifetime")
+    }
+    if !bytes.Equal(data[secretCACertKey], before[secretCACertKey]) || !bytes.Equal(data[secretCAKeyKey], before[secretCAKeyKey]) {
+        t.Error("expected the CA not to be rotated with the serving certificate")
+    }
+    checkServingCert(t, data, *now)
+    if count := countUpdates(client, "mutatingwebhookconfigurations"); count != 1 {
+        t.Errorf("expected the mutating webhook configuration to be updated once, got %d updates", count)
+    }
+}
+
+func TestCertManagerRotatesCA(t *testing.T) {
+    manager, client, now := newTestCertManager(t, webhookConfigurations()...)
+    manager.reconcile(context.TODO())
+    oldCA := parseCertificates(getCertSecret(t, client)[secretCACertKey], certManagerStart)[0]
+
+    /* a serving certificate that is still valid when the CA is rotated */
+    *now = certManagerStart.Add(caValidity/2 - time.Hour)
+    manager.reconcile(context.TODO())
+    before := getCertSecret(t, client)
+
+    *now = certManagerStart.Add(caValidity/2 + time.Hour)
+    manager.reconcile(context.TODO())
+    data := getCertSecret(t, client)
+    caCerts := parseCertificates(data[secretCACertKey], *now)
+    if len(caCerts) != 2 || caCerts[0].Equal(oldCA) || !caCerts[1].Equal(oldCA) {
+        t.Fatalf("expected the bundle to contain the new CA followed by the previous one, got %d certificates", len(caCerts))
+    }
+    if !bytes.Equal(data[core.TLSCertKey], before[core.TLSCertKey]) {
+        t.Error("expected the serving certificate not to be issued by the new CA before the webhooks trust it")
+    }
+    checkWebhookCABundles(t, client, data[secretCACertKey])
+
+    /* the webhooks trust the new CA, so it issues the serving certificate on the next reconcile */
+    client.ClearActions()
+    *now = now.Add(certReconcileInterval)
+    manager.reconcile(context.TODO())
+    data = getCertSecret(t, client)
+    servingCert, _ := checkServingCert(t, data, *now)
+    if verifies(servingCert, oldCA, "aws-secret-injector.injector.svc", *now) {
+        t.Error("expected the serving certificate to be issued by the new CA")
+    }
+    if count := countUpdates(client, "mutatingwebhookconfigurations"); count != 0 {
+        t.Errorf("expected the caBundle to be up to date before the serving certificate is issued, got %d updates", count)
+    }
+
+    /* the previous CA is dropped once it has expired */
+    *now = oldCA.NotAfter.Add(time.Hour)
+    manager.reconcile(context.TODO())
+    data = getCertSecret(t, client)
+    _, caCerts = checkServingCert(t, data, *now)
+    if len(caCerts) != 1 || caCerts[0].Equal(oldCA) {
+        t.Errorf("expected only the new CA to be left in the bundle, got %d certificates", len(caCerts))
+    }
+    checkWebhookCABundles(t, client, data[secretCACertKey])
+}
+
+func TestUpdateWebhookConfigurations(t *testing.T) {
+    mutating := webhookConfigurations()[0]
+    manager, client, _ := newTestCertManager(t, mutating)
+    if err := manager.updateWebhookConfigurations(context.TODO(), []byte("ca")); err != nil {
+        t.Errorf("expected the validating webhook configuration to be optional, got %v", err)
+    }
+    updated, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "aws-secret-injector", meta.GetOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(updated.Webhooks[0].ClientConfig.CABundle) != "ca" || len(updated.Webhooks[1].ClientConfig.CABundle) > 0 {
+        t.Errorf("expected only the webhook calling the injector service to be updated, got %+v", updated.Webhooks)
+    }
+
+    manager, _, _ = newTestCertManager(t)
+    if err := manager.updateWebhookConfigurations(context.TODO(), []byte("ca")); err == nil {
+        t.Error("expected an error without a mutating webhook configuration")
+    }
+}
+
+func TestCertManagerSyncWithoutLease(t *testing.T) {
+    leader, client, now := newTestCertManager(t, webhookConfigurations()...)
+    watcher, err := newCertWatcher("", "", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    follower := newCertManager(client, "injector", "aws-secret-injector-tls", "aws-secret-injector", "aws-secret-injector", watcher)
+
+    follower.sync(context.TODO())
+    if _, err := watcher.load(); err == nil {
+        t.Error("expected no certificate before the secret is created")
+    }
+
+    leader.reconcile(context.TODO())
+    client.ClearActions()
+    follower.sync(context.TODO())
+    for _, action := range client.Actions() {
+        if action.GetVerb() != "get" {
+            t.Errorf("expected a replica without the lease only to read the secret, got %s %s", action.GetVerb(), action.GetResource().Resource)
+        }
+    }
+    certificate, err := watcher.load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    first := certificate.Leaf
+
+    /* the certificate is only reloaded when the leader stores a new one */
+    follower.sync(context.TODO())
+    if certificate, _ := watcher.load(); certificate.Leaf != first {
+        t.Error("expected the same certificate not to be loaded again")
+    }
+    *now = certManagerStart.Add(servingCertValidity/2 + time.Hour)
+    leader.reconcile(context.TODO())
+    follower.sync(context.TODO())
+    if certificate, _ := watcher.load(); certificate.Leaf.Equal(first) {
+        t.Error("expected the renewed certificate to be loaded from the secret")
+    }
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "sync"
+    "time"
+
+    "k8s.io/klog/v2"
+)
+
+// CertWatcher serves the webhook's TLS certificate, re-reading the certificate and key files when they
+// change so that a rotated certificate (e.g. from cert-manager) is picked up without restarting. If no files
+// are given, the certificate is set by the CertManager instead.
+type CertWatcher struct {
+    certFile WatchedFile
+    keyFile WatchedFile
+    certPEM []byte
+    keyPEM []byte
+    mutex sync.Mutex
+    certificate *tls.Certificate
+    expiryWarning time.Duration
+    lastWarning time.Time
+}
+
+var (
+    certWatcher *CertWatcher
+)
+
+// newCertWatcher creates a CertWatcher for the given files, loading the certificate straight away so that
+// a missing or invalid certificate is reported at startup.
+func newCertWatcher(certFile string, keyFile string, expiryWarning time.Duration) (*CertWatcher, error) {
+    w := &CertWatcher{
+        certFile: WatchedFile{path: certFile},
+        keyFile: WatchedFile{path: keyFile},
+        expiryWarning: expiryWarning,
+    }
+    if certFile == "" {
+        return w, nil
+    }
+    if _, err := w.load(); err != nil {
+        return nil, err
+    }
+    w.checkExpiry()
+    return w, nil
+}
+
+// load returns the current certificate, re-reading the files if either of them has been modified. If the new
+// files cannot be loaded (e.g. because only one of them has been updated so far), the previous certificate
+// continues to be used and the files are read again next time.
+func (w *CertWatcher) load() (*tls.Certificate, error) {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if w.certFile.path == "" {
+        if w.certificate == nil {
+            return nil, fmt.Errorf("No TLS certificate has been loaded yet")
+        }
+        return w.certificate, nil
+    }
+    certPEM, certChanged, err := w.certFile.readIfChanged()
+    if err != nil {
+        return w.certificate, fmt.Errorf("Unable to read TLS certificate %s: %v", w.certFile.path, err)
+    }
+    keyPEM, keyChanged, err := w.keyFile.readIfChanged()
+    if err != nil {
+        w.certFile.read = false
+        return w.certificate, fmt.Errorf("Unable to read TLS private key %s: %v", w.keyFile.path, err)
+    }
+    if !certChanged && !keyChanged {
+        return w.certificate, nil
+    }
+    if certChanged {
+        w.certPEM = certPEM
+    }
+    if keyChanged {
+        w.keyPEM = keyPEM
+    }
+    if err := w.update(w.certPEM, w.keyPEM, w.certFile.path); err != nil {
+        w.certFile.read, w.keyFile.read = false, false
+        return w.certificate, fmt.Errorf("Unable to load TLS certificate %s and key %s: %v", w.certFile.path, w.keyFile.path, err)
+    }
+    return w.certificate, nil
+}
+
+// set replaces the current certificate, e.g. with one read from a Secret.
+func (w *CertWatcher) set(certPEM []byte, keyPEM []byte, source string) error {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if err := w.update(certPEM, keyPEM, source); err != nil {
+        return fmt.Errorf("Unable to load TLS certificate from %s: %v", source, err)
+    }
+    return nil
+}
+
+// update parses and switches to a new certificate. The caller must hold the mutex.
+func (w *CertWatcher) update(certPEM []byte, keyPEM []byte, source string) error {
+    certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+    if err == nil && len(certificate.Certificate) > 0 {
+        certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+    }
+    if err != nil {
+        return err
+    }
+    klog.Info("Loaded TLS certificate from ", source, " for ", certificate.Leaf.Subject.CommonName, " expiring ", certificate.Leaf.NotAfter.Format(time.RFC3339))
+    w.certificate = &certificate
+    certificateExpiry.Set(float64(certificate.Leaf.NotAfter.Unix()))
+    w.lastWarning = time.Time{}
+    return nil
+}
+
+// checkExpiry logs a warning if the current certificate has expired or will expire soon. The warning is
+// repeated at most once an hour, or when a new certificate is loaded.
+func (w *CertWatcher) checkExpiry() {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if w.certificate == nil || w.certificate.Leaf == nil || time.Since(w.lastWarning) < time.Hour {
+        return
+    }
+    remaining := time.Until(w.certificate.Leaf.NotAfter)
+    if remaining < w.expiryWarning {
+        w.lastWarning = time.Now()
+    }
+    if remaining <= 0 {
+        klog.Error("TLS certificate for ", w.certificate.Leaf.Subject.CommonName, " expired at ", w.certificate.Leaf.NotAfter.Format(time.RFC3339))
+    } else if remaining < w.expiryWarning {
+        klog.Warning("TLS certificate for ", w.certificate.Leaf.Subject.CommonName, " expires in ", remaining.Round(time.Minute), " at ", w.certificate.Leaf.NotAfter.Format(time.RFC3339))
+    }
+}
+
+// GetCertificate is used as the tls.Config callback, so that every handshake uses the latest certificate.
+func (w *CertWatcher) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    certificate, err := w.load()
+    if err != nil {
+        klog.Error(err)
+    }
+    if certificate == nil {
+        return nil, err
+    }
+    return certificate, nil
+}
+
+// watch reloads the certificate and checks its expiry periodically, so that warnings are logged even if
+// no requests are being made.
+func (w *CertWatcher) watch(interval time.Duration) {
+    for range time.Tick(interval) {
+        if _, err := w.load(); err != nil {
+            klog.Error(err)
+        }
+        w.checkExpiry()
+    }
+}
@@ -18,13 +18,43 @@ package main
 
 import (
     "flag"
+    "time"
 )
 
-// Config contains the server (the webhook) cert and key.
+// Config contains the server (the webhook) cert and key, and the other command line settings.
 type Config struct {
     CertFile string
     KeyFile  string
     InitContainerImage string
+    Kubeconfig string
+    DefaultRegion string
+    PolicyFile string
+    RulesFile string
+    CertExpiryWarning time.Duration
+    ManageCertificates bool
+    CertificateSecret string
+    Namespace string
+    ServiceName string
+    WebhookName string
+    ListenAddress string
+    HealthAddress string
+    TLSMinVersion string
+    TLSCipherSuites string
+    ClientCAFile string
+    ClientAllowedNames string
+    ReadHeaderTimeout time.Duration
+    ReadTimeout time.Duration
+    WriteTimeout time.Duration
+    IdleTimeout time.Duration
+    ShutdownDelay time.Duration
+    ShutdownTimeout time.Duration
+    LogFormat string
+    RedactAnnotations string
+    AuditLog string
+    Events bool
+    EventQPS float64
+    EventBurst int
+    Explain bool
 }
 
 func (c *Config) addFlags() {
@@ -33,6 +63,72 @@ func (c *Config) addFlags() {
         "after server cert).")
     flag.StringVar(&c.KeyFile, "tls-private-key-file", c.KeyFile, ""+
         "File containing the default x509 private key matching --tls-cert-file.")
+    flag.DurationVar(&c.CertExpiryWarning, "tls-cert-expiry-warning", 30*24*time.Hour,
+        "Log a warning when the certificate in --tls-cert-file expires within this time.")
+    flag.BoolVar(&c.ManageCertificates, "manage-certificates", c.ManageCertificates,
+        "Generate and rotate a CA and serving certificate, stored in --certificate-secret, and set the caBundle "+
+        "of the webhook configurations. --tls-cert-file and --tls-private-key-file are not used.")
+    flag.StringVar(&c.CertificateSecret, "certificate-secret", "aws-secret-injector-certs",
+        "Name of the Secret holding the certificates when --manage-certificates is set. A Lease with the same "+
+        "name makes sure only one replica changes the certificates.")
+    flag.StringVar(&c.Namespace, "namespace", c.Namespace,
+        "Namespace of the admission controller's service and certificate secret. Defaults to the namespace it is running in.")
+    flag.StringVar(&c.ServiceName, "service-name", "aws-secret-injector",
+        "Name of the admission controller's service, used for the serving certificate when --manage-certificates is set.")
+    flag.StringVar(&c.WebhookName, "webhook-name", "aws-secret-injector",
+        "Name of the webhook configurations whose caBundle is set when --manage-certificates is set.")
     flag.StringVar(&c.InitContainerImage, "init-container-image", c.InitContainerImage,
         "Image to be used for the init container")
+    flag.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig,
+        "Path to a kubeconfig file. If not set, the in-cluster configuration is used.")
+    flag.StringVar(&c.DefaultRegion, "default-region", c.DefaultRegion,
+        "AWS region for secrets listed by name, when neither the pod nor its namespace has a secrets.aws.k8s/region annotation.")
+    flag.StringVar(&c.PolicyFile, "policy-file", c.PolicyFile,
+        "File containing the secret access policy. If not set, pods may request any secret.")
+    flag.StringVar(&c.RulesFile, "rules-file", c.RulesFile,
+        "File containing CEL rules that are evaluated for each secret a pod requests.")
+    flag.StringVar(&c.ListenAddress, "listen-address", ":8443",
+        "Address the webhooks are served on, over HTTPS.")
+    flag.StringVar(&c.HealthAddress, "health-address", ":8080",
+        "Address /healthz, /readyz and /metrics are served on, over plain HTTP. If empty, they are served on --listen-address.")
+    flag.StringVar(&c.TLSMinVersion, "tls-min-version", "1.2",
+        "Minimum TLS version accepted by the webhook server (1.2 or 1.3).")
+    flag.StringVar(&c.TLSCipherSuites, "tls-cipher-suites", c.TLSCipherSuites,
+        "Comma-separated list of TLS 1.2 cipher suites accepted by the webhook server, e.g. "+
+        "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. If empty, Go's default (secure) cipher suites are used.")
+    flag.StringVar(&c.ClientCAFile, "client-ca-file", c.ClientCAFile,
+        "File containing the CA certificates for client certificates. If set, callers of the webhooks (i.e. the "+
+        "API server) must present a client certificate issued by one of these CAs.")
+    flag.StringVar(&c.ClientAllowedNames, "client-allowed-names", c.ClientAllowedNames,
+        "Comma-separated list of the common names or DNS names of the client certificates that are allowed when "+
+        "--client-ca-file is set. If empty, any certificate issued by the CA is allowed.")
+    flag.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", 10*time.Second,
+        "Maximum time to read the headers of a request.")
+    flag.DurationVar(&c.ReadTimeout, "read-timeout", 30*time.Second,
+        "Maximum time to read a request, including the body.")
+    flag.DurationVar(&c.WriteTimeout, "write-timeout", 30*time.Second,
+        "Maximum time from the end of the request headers to the end of the response.")
+    flag.DurationVar(&c.IdleTimeout, "idle-timeout", 120*time.Second,
+        "Maximum time to keep an idle connection open.")
+    flag.DurationVar(&c.ShutdownDelay, "shutdown-delay", 5*time.Second,
+        "Time to keep serving after SIGTERM while reporting not ready, so the pod can be removed from the service's endpoints.")
+    flag.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 20*time.Second,
+        "Maximum time to wait for requests in flight to complete when shutting down.")
+    flag.StringVar(&c.LogFormat, "log-format", "text",
+        "Log format, text or json. The init container uses the same format.")
+    flag.StringVar(&c.RedactAnnotations, "redact-annotations", "kubectl.kubernetes.io/last-applied-configuration",
+        "Comma-separated list of annotations whose values are not logged, e.g. example.com/*. Env var values and "+
+        "anything that looks like a credential are never logged.")
+    flag.StringVar(&c.AuditLog, "audit-log", c.AuditLog,
+        "File the audit log is appended to, as JSON lines, or - for stdout. If empty, there is no audit log.")
+    flag.BoolVar(&c.Events, "events", true,
+        "Emit Kubernetes Events about injected, skipped and denied secrets on the pod's workload, or on the pod if it has no owner.")
+    flag.Float64Var(&c.EventQPS, "event-qps", 0.1,
+        "Maximum rate of events per second for each workload or pod, after --event-burst events.")
+    flag.IntVar(&c.EventBurst, "event-burst", 25,
+        "Number of events that can be emitted for a workload or pod before --event-qps applies.")
+    flag.BoolVar(&c.Explain, "explain", c.Explain,
+        "Serve /explain on --listen-address, which explains what would happen to a pod to callers with a bearer "+
+        "token for a user that can create pods in its namespace. If --client-ca-file is set, callers also need a "+
+        "client certificate issued by that CA, as for the webhooks.")
 }
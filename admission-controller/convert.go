@@ -17,16 +17,112 @@ limitations under the License.
 package main
 
 import (
+	"errors"
+	"net/http"
+
 	admission "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// admissionError is an error that is reported in an AdmissionResponse with a specific code and reason. The
+// cause says why the request was denied in the metrics and audit log, and is one of the denied* constants.
+type admissionError struct {
+	err    error
+	code   int32
+	reason meta.StatusReason
+	cause  string
+}
+
+func (e *admissionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *admissionError) Unwrap() error {
+	return e.err
+}
+
+// badRequest marks an error as being caused by a problem with the object in the request.
+func badRequest(cause string, err error) error {
+	return &admissionError{err: err, code: http.StatusBadRequest, reason: meta.StatusReasonBadRequest, cause: cause}
+}
+
+// internalError marks an error as being caused by a problem in the webhook or its dependencies.
+func internalError(cause string, err error) error {
+	return &admissionError{err: err, code: http.StatusInternalServerError, reason: meta.StatusReasonInternalError, cause: cause}
+}
+
+// forbidden marks an error as a decision not to allow the request, e.g. by the secret access policy.
+func forbidden(cause string, err error) error {
+	return &admissionError{err: err, code: http.StatusForbidden, reason: meta.StatusReasonForbidden, cause: cause}
+}
+
+// denialCause returns why a request was denied because of err.
+func denialCause(err error) string {
+	var e *admissionError
+	if errors.As(err, &e) && e.cause != "" {
+		return e.cause
+	}
+	return deniedOther
+}
+
+// toV1AdmissionResponse creates a response that denies the request because of err. Unless err says
+// otherwise, the request is reported as forbidden.
 func toV1AdmissionResponse(err error, ar admission.AdmissionReview) *admission.AdmissionResponse {
+	status := admissionError{err: err, code: http.StatusForbidden, reason: meta.StatusReasonForbidden, cause: deniedOther}
+	var e *admissionError
+	if errors.As(err, &e) {
+		status = *e
+	}
 	return &admission.AdmissionResponse{
-		UID: ar.Request.UID,
+		UID:     ar.Request.UID,
 		Allowed: false,
 		Result: &meta.Status{
+			Status:  meta.StatusFailure,
 			Message: err.Error(),
+			Reason:  status.reason,
+			Code:    status.code,
 		},
 	}
 }
+
+// convertAdmissionRequestToV1 converts a v1beta1 AdmissionRequest so that it can be handled by the v1 flow.
+// The two versions have the same fields.
+func convertAdmissionRequestToV1(r *admissionv1beta1.AdmissionRequest) *admission.AdmissionRequest {
+	return &admission.AdmissionRequest{
+		Kind:               r.Kind,
+		Namespace:          r.Namespace,
+		Name:               r.Name,
+		Object:             r.Object,
+		Resource:           r.Resource,
+		Operation:          admission.Operation(r.Operation),
+		UID:                r.UID,
+		DryRun:             r.DryRun,
+		OldObject:          r.OldObject,
+		Options:            r.Options,
+		RequestKind:        r.RequestKind,
+		RequestResource:    r.RequestResource,
+		RequestSubResource: r.RequestSubResource,
+		SubResource:        r.SubResource,
+		UserInfo:           r.UserInfo,
+	}
+}
+
+// convertAdmissionResponseToV1beta1 converts a v1 AdmissionResponse so that it can be returned to a caller
+// that sent a v1beta1 AdmissionReview.
+func convertAdmissionResponseToV1beta1(r *admission.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	var patchType *admissionv1beta1.PatchType
+	if r.PatchType != nil {
+		t := admissionv1beta1.PatchType(*r.PatchType)
+		patchType = &t
+	}
+	return &admissionv1beta1.AdmissionResponse{
+		UID:              r.UID,
+		Allowed:          r.Allowed,
+		AuditAnnotations: r.AuditAnnotations,
+		Patch:            r.Patch,
+		PatchType:        patchType,
+		Result:           r.Result,
+		Warnings:         r.Warnings,
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "fmt"
+
+    core "k8s.io/api/core/v1"
+)
+
+const (
+    podIdentityTokenVolumeName = "eks-pod-identity-token"
+    podIdentityTokenMountPath = "/var/run/secrets/pods.eks.amazonaws.com/serviceaccount"
+)
+
+// CredentialMechanism identifies how the init container obtains AWS credentials.
+type CredentialMechanism string
+
+const (
+    // CredentialMechanismIRSA uses the token volume added by the EKS pod identity webhook.
+    CredentialMechanismIRSA CredentialMechanism = "irsa"
+    // CredentialMechanismIRSAProjected uses a token volume added by this webhook.
+    CredentialMechanismIRSAProjected CredentialMechanism = "irsa-projected"
+    // CredentialMechanismPodIdentity uses the EKS Pod Identity agent.
+    CredentialMechanismPodIdentity CredentialMechanism = "eks-pod-identity"
+    // CredentialMechanismDefault leaves the AWS SDK to use its default credential chain (e.g. the node role).
+    CredentialMechanismDefault CredentialMechanism = "default"
+)
+
+// CredentialConfig holds the settings required for the init container to obtain AWS credentials.
+type CredentialConfig struct {
+    Mechanism CredentialMechanism
+    Env []core.EnvVar
+    VolumeMounts []core.VolumeMount
+    Volumes []core.Volume // volumes that need to be added to the pod
+    Warnings []string
+}
+
+// getCredentialConfig decides which credential mechanism the init container should use.
+// IRSA takes precedence over EKS Pod Identity, matching the order of the AWS SDK credential chain.
+func getCredentialConfig(pod core.Pod, namespace string, log requestLogger) (CredentialConfig, error) {
+    credentialConfig := CredentialConfig{Mechanism: CredentialMechanismDefault}
+    var roleArn core.EnvVar
+    if hasVolume(pod.Spec.Volumes, irsaTokenVolumeName) {
+        /* pod has already been through the IRSA webhook, so we need to do some work */
+        serviceAccountRoleArn := ""
+        if _, err := getRoleArn(pod.Spec.Containers); err == nil && clientset == nil && !offline {
+            /* the containers already have a role, so don't deny the pod because the service account can't be checked */
+            log.info("No Kubernetes client available, using AWS_ROLE_ARN from the containers without looking up the service account")
+        } else if serviceAccountRoleArn, err = getServiceAccountRoleArn(namespace, pod.Spec.ServiceAccountName, log); err != nil {
+            return credentialConfig, err
+        }
+        var warnings []string
+        var err error
+        roleArn, warnings, err = resolveRoleArn(pod.Spec.Containers, serviceAccountRoleArn)
+        if err != nil {
+            return credentialConfig, err
+        }
+        credentialConfig.Mechanism = CredentialMechanismIRSA
+        credentialConfig.Warnings = warnings
+    } else if env, volumeMount, ok := getPodIdentityConfig(pod); ok {
+        /* pod has been through the EKS Pod Identity webhook, so copy its settings */
+        credentialConfig.Mechanism = CredentialMechanismPodIdentity
+        credentialConfig.Env = env
+        credentialConfig.VolumeMounts = []core.VolumeMount{volumeMount}
+        return credentialConfig, nil
+    } else {
+        /* the IRSA webhook has not run (yet), so look up the role and project the token ourselves */
+        serviceAccountRoleArn, err := getServiceAccountRoleArn(namespace, pod.Spec.ServiceAccountName, log)
+        if err != nil {
+            return credentialConfig, err
+        }
+        if serviceAccountRoleArn == "" {
+            log.info("Service account has no "+irsaRoleArnAnnotation+" annotation")
+            return credentialConfig, nil
+        }
+        log.info("Adding a projected service account token volume", "volume", irsaTokenVolumeName)
+        roleArn = core.EnvVar{Name: "AWS_ROLE_ARN", Value: serviceAccountRoleArn}
+        credentialConfig.Mechanism = CredentialMechanismIRSAProjected
+        credentialConfig.Volumes = []core.Volume{irsaTokenVolume()}
+    }
+    credentialConfig.VolumeMounts = []core.VolumeMount{
+        core.VolumeMount{
+            Name: irsaTokenVolumeName,
+            MountPath: irsaTokenMountPath,
+            ReadOnly: true,
+        },
+    }
+    credentialConfig.Env = []core.EnvVar{
+        roleArn,
+        core.EnvVar{
+            Name: "AWS_WEB_IDENTITY_TOKEN_FILE",
+            Value: irsaTokenMountPath + "/token",
+        },
+    }
+    return credentialConfig, nil
+}
+
+// resolveRoleArn works out the AWS_ROLE_ARN env var for the init container. The service account annotation
+// is preferred, with a warning if the containers say otherwise. Without the annotation, the containers' env
+// vars are used.
+func resolveRoleArn(containers []core.Container, serviceAccountRoleArn string) (core.EnvVar, []string, error) {
+    containerRoleArn, err := getRoleArn(containers)
+    if serviceAccountRoleArn == "" {
+        if err == errRoleArnNotFound {
+            return containerRoleArn, nil, badRequest(deniedCredentials, err)
+        }
+        return containerRoleArn, nil, err
+    }
+    var warnings []string
+    if err != nil && err != errRoleArnNotFound {
+        warnings = append(warnings, fmt.Sprintf("%s; the init container will use role %s from the service account", err, serviceAccountRoleArn))
+    } else if err == nil && (containerRoleArn.ValueFrom != nil || containerRoleArn.Value != serviceAccountRoleArn) {
+        warnings = append(warnings, fmt.Sprintf("AWS_ROLE_ARN set on the containers does not match the service account annotation %s; the init container will use role %s", irsaRoleArnAnnotation, serviceAccountRoleArn))
+    }
+    return core.EnvVar{Name: "AWS_ROLE_ARN", Value: serviceAccountRoleArn}, warnings, nil
+}
+
+// getPodIdentityConfig finds the environment variables and token mount added by the EKS Pod Identity webhook.
+func getPodIdentityConfig(pod core.Pod) ([]core.EnvVar, core.VolumeMount, bool) {
+    if !hasVolume(pod.Spec.Volumes, podIdentityTokenVolumeName) {
+        return nil, core.VolumeMount{}, false
+    }
+    for _, container := range pod.Spec.Containers {
+        var env []core.EnvVar
+        for _, envVar := range container.Env {
+            if envVar.Name == "AWS_CONTAINER_CREDENTIALS_FULL_URI" || envVar.Name == "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE" {
+                env = append(env, envVar)
+            }
+        }
+        if len(env) != 2 {
+            continue
+        }
+        volumeMount := core.VolumeMount{
+            Name: podIdentityTokenVolumeName,
+            MountPath: podIdentityTokenMountPath,
+        }
+        for _, containerVolumeMount := range container.VolumeMounts {
+            if containerVolumeMount.Name == podIdentityTokenVolumeName {
+                volumeMount = containerVolumeMount
+            }
+        }
+        volumeMount.ReadOnly = true
+        return env, volumeMount, true
+    }
+    return nil, core.VolumeMount{}, false
+}
+
+// describe returns a human-readable description of the credential mechanism.
+func (m CredentialMechanism) describe() string {
+    switch m {
+    case CredentialMechanismIRSA:
+        return "IRSA web identity token added by the EKS pod identity webhook"
+    case CredentialMechanismIRSAProjected:
+        return fmt.Sprintf("IRSA web identity token projected by aws-secret-injector (audience %s)", irsaTokenAudience)
+    case CredentialMechanismPodIdentity:
+        return "EKS Pod Identity"
+    default:
+        return "default AWS credential chain (e.g. node role)"
+    }
+}
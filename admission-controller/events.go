@@ -0,0 +1,273 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    core "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/record"
+    "k8s.io/client-go/util/workqueue"
+    "k8s.io/klog/v2"
+)
+
+const (
+    eventComponent = "aws-secret-injector"
+    eventLookupTimeout = 2 * time.Second
+    /* how long to wait for a pod without an owner to be created, so that an event can be attached to it */
+    podCreationTimeout = 30 * time.Second
+    podCreationPollInterval = time.Second
+    /* how many pods without an owner can be waited for at once; the events of any more are dropped */
+    maxPendingPods = 100
+)
+
+// EventEmitter tells developers what happened to the secret injection annotations of their pods, with Events on
+// the pod's workload (e.g. its Deployment), or on the pod itself once it has been created if it has no owner.
+// The events go through a rate-limited recorder, so a workload with many pods gets a few events rather than
+// one per pod. A single worker waits for pods without an owner to be created, taking them from a queue.
+type EventEmitter struct {
+    client kubernetes.Interface
+    broadcaster record.EventBroadcaster
+    recorder record.EventRecorder
+    podTimeout time.Duration
+    pollInterval time.Duration
+    queue workqueue.DelayingInterface
+    mutex sync.Mutex
+    /* pods without an owner that are waiting to be created, by namespace/name */
+    pending map[string]*pendingPod
+}
+
+// pendingPod holds the events about a pod without an owner until the pod has been created.
+type pendingPod struct {
+    namespace string
+    name string
+    events []injectionEvent
+    deadline time.Time
+}
+
+// injectionEvent is an Event to be emitted about a pod.
+type injectionEvent struct {
+    eventType string
+    reason string
+    message string
+}
+
+var (
+    eventEmitter *EventEmitter
+)
+
+// newEventEmitter creates an EventEmitter that allows a burst of events per object, and then qps events per second.
+func newEventEmitter(client kubernetes.Interface, qps float32, burst int) *EventEmitter {
+    broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{QPS: qps, BurstSize: burst})
+    broadcaster.StartRecordingToSink(eventSink{client: client})
+    e := &EventEmitter{
+        client: client,
+        broadcaster: broadcaster,
+        recorder: broadcaster.NewRecorder(scheme, core.EventSource{Component: eventComponent}),
+        podTimeout: podCreationTimeout,
+        pollInterval: podCreationPollInterval,
+        queue: workqueue.NewNamedDelayingQueue("pending-pods"),
+        pending: map[string]*pendingPod{},
+    }
+    go e.attachToPods()
+    return e
+}
+
+// eventSink writes events using a client for the event's namespace, as the fake clientset requires.
+type eventSink struct {
+    client kubernetes.Interface
+}
+
+func (s eventSink) Create(event *core.Event) (*core.Event, error) {
+    return s.client.CoreV1().Events(event.Namespace).CreateWithEventNamespace(event)
+}
+
+func (s eventSink) Update(event *core.Event) (*core.Event, error) {
+    return s.client.CoreV1().Events(event.Namespace).UpdateWithEventNamespace(event)
+}
+
+func (s eventSink) Patch(event *core.Event, data []byte) (*core.Event, error) {
+    return s.client.CoreV1().Events(event.Namespace).PatchWithEventNamespace(event, data)
+}
+
+// shutdown stops sending events.
+func (e *EventEmitter) shutdown() {
+    if e != nil {
+        e.queue.ShutDown()
+        e.broadcaster.Shutdown()
+    }
+}
+
+// emit describes the outcome of an admission request for a pod in Events, in the background. Nothing is emitted
+// for pods without secret injection annotations, or for dry runs.
+func (e *EventEmitter) emit(pod *core.Pod, audit *AuditEvent) {
+    if e == nil || audit.DryRun {
+        return
+    }
+    events := injectionEvents(audit)
+    if len(events) == 0 {
+        return
+    }
+    if owner := meta.GetControllerOf(pod); owner != nil {
+        go func() { e.record(e.workload(audit.Namespace, owner), events) }()
+        return
+    }
+    var reason string
+    switch {
+    case audit.Outcome == "denied":
+        reason = "pod has no owner and was not created"
+    case pod.ObjectMeta.Name == "":
+        reason = "pod has no owner or name"
+    case !e.waitForPod(audit.Namespace, pod.ObjectMeta.Name, events):
+        reason = fmt.Sprintf("pod has no owner and %d other pods are waiting to be created", maxPendingPods)
+    default:
+        return
+    }
+    klog.V(2).InfoS("No object to attach events to", "uid", audit.RequestUID, "namespace", audit.Namespace, "pod", audit.Name, "reason", reason)
+}
+
+func (e *EventEmitter) record(target *core.ObjectReference, events []injectionEvent) {
+    for _, event := range events {
+        e.recorder.Event(target, event.eventType, event.reason, event.message)
+    }
+}
+
+// injectionEvents describes the outcome of an admission request. Pods without secret injection annotations
+// have nothing to report.
+func injectionEvents(audit *AuditEvent) []injectionEvent {
+    if audit.InjectorWebhook == "" {
+        return nil
+    }
+    var events []injectionEvent
+    switch {
+    case audit.Outcome == "mutated":
+        secrets := append(append([]string{}, audit.SecretArns...), audit.SecretNames...)
+        events = append(events, injectionEvent{core.EventTypeNormal, "SecretsInjected",
+            fmt.Sprintf("Injected secrets %s into pod %s with an init container, using the %s credential mechanism", strings.Join(secrets, ", "), audit.Name, audit.CredentialMechanism)})
+    case audit.Outcome == "denied":
+        events = append(events, injectionEvent{core.EventTypeWarning, "SecretInjectionDenied",
+            fmt.Sprintf("Pod %s was denied: %s", audit.Name, audit.Message)})
+    case audit.Outcome == "skipped" && audit.Reason == skippedUnsupportedInjector:
+        events = append(events, injectionEvent{core.EventTypeWarning, "SecretInjectionSkipped",
+            fmt.Sprintf("Secrets were not injected into pod %s: secrets.aws.k8s/injectorWebhook is %q, expected init-container", audit.Name, audit.InjectorWebhook)})
+    }
+    if len(audit.Warnings) > 0 {
+        events = append(events, injectionEvent{core.EventTypeWarning, "SecretInjectionWarning",
+            fmt.Sprintf("Pod %s: %s", audit.Name, strings.Join(audit.Warnings, "; "))})
+    }
+    return events
+}
+
+// waitForPod queues the events about a pod without an owner until the pod has been created, returning false if
+// too many pods are already waiting.
+func (e *EventEmitter) waitForPod(namespace string, name string, events []injectionEvent) bool {
+    key := namespace + "/" + name
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    if _, ok := e.pending[key]; !ok && len(e.pending) >= maxPendingPods {
+        return false
+    }
+    e.pending[key] = &pendingPod{namespace: namespace, name: name, events: events, deadline: time.Now().Add(e.podTimeout)}
+    e.queue.Add(key)
+    return true
+}
+
+// attachToPods emits the events about pods without an owner as they are created, until the queue is shut down.
+func (e *EventEmitter) attachToPods() {
+    for {
+        key, shutdown := e.queue.Get()
+        if shutdown {
+            return
+        }
+        e.attachToPod(key.(string))
+        e.queue.Done(key)
+    }
+}
+
+// attachToPod emits the events about a pod if it has been created, or checks again after the poll interval
+// until the pod's deadline has passed.
+func (e *EventEmitter) attachToPod(key string) {
+    e.mutex.Lock()
+    pending := e.pending[key]
+    e.mutex.Unlock()
+    if pending == nil {
+        return
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), eventLookupTimeout)
+    defer cancel()
+    created, err := e.client.CoreV1().Pods(pending.namespace).Get(ctx, pending.name, meta.GetOptions{})
+    if err == nil {
+        e.forget(key, pending)
+        e.record(&core.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: pending.namespace, Name: created.Name, UID: created.UID}, pending.events)
+        return
+    }
+    if !errors.IsNotFound(err) {
+        klog.V(2).InfoS("Unable to look up pod", "namespace", pending.namespace, "pod", pending.name, "err", err)
+    }
+    if time.Now().After(pending.deadline) {
+        e.forget(key, pending)
+        klog.V(2).InfoS("No object to attach events to", "namespace", pending.namespace, "pod", pending.name, "reason", fmt.Sprintf("pod was not created within %v", e.podTimeout))
+        return
+    }
+    e.queue.AddAfter(key, e.pollInterval)
+}
+
+// forget stops waiting for a pod, unless it has been admitted again in the meantime.
+func (e *EventEmitter) forget(key string, pending *pendingPod) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    if e.pending[key] == pending {
+        delete(e.pending, key)
+    }
+}
+
+// workload follows the owner of a pod up to the workload that developers manage, i.e. from a ReplicaSet to its
+// Deployment and from a Job to its CronJob. If the owner cannot be looked up, the events go on the owner itself.
+func (e *EventEmitter) workload(namespace string, owner *meta.OwnerReference) *core.ObjectReference {
+    reference := ownerReference(namespace, owner)
+    ctx, cancel := context.WithTimeout(context.Background(), eventLookupTimeout)
+    defer cancel()
+    var object meta.Object
+    var err error
+    switch {
+    case owner.Kind == "ReplicaSet" && owner.APIVersion == "apps/v1":
+        object, err = e.client.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, meta.GetOptions{})
+    case owner.Kind == "Job" && owner.APIVersion == "batch/v1":
+        object, err = e.client.BatchV1().Jobs(namespace).Get(ctx, owner.Name, meta.GetOptions{})
+    default:
+        return reference
+    }
+    if err != nil {
+        klog.V(2).InfoS("Unable to look up the owner of a pod", "namespace", namespace, "kind", owner.Kind, "name", owner.Name, "err", err)
+        return reference
+    }
+    if workload := meta.GetControllerOfNoCopy(object); workload != nil {
+        return ownerReference(namespace, workload)
+    }
+    return reference
+}
+
+func ownerReference(namespace string, owner *meta.OwnerReference) *core.ObjectReference {
+    return &core.ObjectReference{Kind: owner.Kind, APIVersion: owner.APIVersion, Namespace: namespace, Name: owner.Name, UID: owner.UID}
+}
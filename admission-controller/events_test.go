@@ -0,0 +1,240 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "testing"
+    "time"
+
+    apps "k8s.io/api/apps/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/wait"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+    controller = true
+    deployment = &apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team-a", UID: "deployment-uid"}}
+    replicaSet = &apps.ReplicaSet{ObjectMeta: meta.ObjectMeta{Name: "app-5d9c", Namespace: "team-a", UID: "replicaset-uid",
+        OwnerReferences: []meta.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "deployment-uid", Controller: &controller}}}}
+)
+
+// replicaSetPod is a pod created by the test ReplicaSet, as it is when it is admitted.
+func replicaSetPod() *core.Pod {
+    return &core.Pod{ObjectMeta: meta.ObjectMeta{GenerateName: "app-5d9c-", Namespace: "team-a",
+        OwnerReferences: []meta.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app-5d9c", UID: "replicaset-uid", Controller: &controller}}}}
+}
+
+func mutatedAudit(name string) *AuditEvent {
+    return &AuditEvent{
+        Namespace: "team-a",
+        Name: name,
+        Outcome: "mutated",
+        InjectorWebhook: "init-container",
+        SecretNames: []string{"team-a/db"},
+        CredentialMechanism: "irsa",
+    }
+}
+
+// waitForEvents waits for the expected number of events in the namespace, and makes sure no more arrive.
+func waitForEvents(t *testing.T, client *fake.Clientset, namespace string, expected int) []core.Event {
+    t.Helper()
+    var events []core.Event
+    list := func() (bool, error) {
+        result, err := client.CoreV1().Events(namespace).List(context.Background(), meta.ListOptions{})
+        if err != nil {
+            return false, err
+        }
+        events = result.Items
+        return len(events) >= expected, nil
+    }
+    if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, list); err != nil {
+        t.Fatalf("expected %d events, got %d: %v", expected, len(events), err)
+    }
+    time.Sleep(200 * time.Millisecond)
+    list()
+    if len(events) != expected {
+        t.Fatalf("expected %d events, got %d: %+v", expected, len(events), events)
+    }
+    return events
+}
+
+func TestEventOnWorkload(t *testing.T) {
+    client := fake.NewSimpleClientset(deployment, replicaSet)
+    emitter := newEventEmitter(client, 1, 25)
+    defer emitter.shutdown()
+
+    audit := mutatedAudit("app-5d9c-*")
+    audit.Warnings = []string{"Unknown annotation secrets.aws.k8s/secretname"}
+    emitter.emit(replicaSetPod(), audit)
+
+    events := waitForEvents(t, client, "team-a", 2)
+    for _, event := range events {
+        if event.InvolvedObject.Kind != "Deployment" || event.InvolvedObject.Name != "app" || event.InvolvedObject.UID != "deployment-uid" {
+            t.Errorf("expected the event to be on the Deployment, got %+v", event.InvolvedObject)
+        }
+        if event.Source.Component != eventComponent {
+            t.Errorf("unexpected event source %+v", event.Source)
+        }
+    }
+    reasons := map[string]string{}
+    for _, event := range events {
+        reasons[event.Reason] = event.Type
+    }
+    if reasons["SecretsInjected"] != core.EventTypeNormal || reasons["SecretInjectionWarning"] != core.EventTypeWarning {
+        t.Errorf("expected an injected event and a warning, got %v", reasons)
+    }
+}
+
+func TestEventLookupDoesNotBlock(t *testing.T) {
+    client := fake.NewSimpleClientset(deployment, replicaSet)
+    release := make(chan struct{})
+    client.PrependReactor("get", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        <-release
+        return false, nil, nil
+    })
+    emitter := newEventEmitter(client, 1, 25)
+    defer emitter.shutdown()
+
+    emitted := make(chan struct{})
+    go func() {
+        emitter.emit(replicaSetPod(), mutatedAudit("app-5d9c-*"))
+        close(emitted)
+    }()
+    select {
+    case <-emitted:
+    case <-time.After(time.Second):
+        close(release)
+        t.Fatal("expected emit to return while the owner is being looked up")
+    }
+    close(release)
+    events := waitForEvents(t, client, "team-a", 1)
+    if events[0].InvolvedObject.Kind != "Deployment" {
+        t.Errorf("expected the event to be on the Deployment, got %+v", events[0].InvolvedObject)
+    }
+}
+
+func TestEventOnOwnerWithoutWorkload(t *testing.T) {
+    client := fake.NewSimpleClientset()
+    emitter := newEventEmitter(client, 1, 25)
+    defer emitter.shutdown()
+
+    audit := mutatedAudit("app-5d9c-*")
+    audit.Outcome, audit.Message = "denied", "Secret access policy does not allow it"
+    emitter.emit(replicaSetPod(), audit)
+
+    events := waitForEvents(t, client, "team-a", 1)
+    if events[0].InvolvedObject.Kind != "ReplicaSet" || events[0].Reason != "SecretInjectionDenied" || events[0].Type != core.EventTypeWarning {
+        t.Errorf("expected a denied event on the ReplicaSet, got %+v", events[0])
+    }
+}
+
+func TestEventOnPodAfterCreation(t *testing.T) {
+    client := fake.NewSimpleClientset()
+    emitter := newEventEmitter(client, 1, 25)
+    emitter.pollInterval = 10 * time.Millisecond
+    defer emitter.shutdown()
+
+    pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare", Namespace: "team-a"}}
+    emitter.emit(pod, mutatedAudit("bare"))
+    time.Sleep(50 * time.Millisecond)
+    created := pod.DeepCopy()
+    created.UID = "pod-uid"
+    if _, err := client.CoreV1().Pods("team-a").Create(context.Background(), created, meta.CreateOptions{}); err != nil {
+        t.Fatal(err)
+    }
+
+    events := waitForEvents(t, client, "team-a", 1)
+    if events[0].InvolvedObject.Kind != "Pod" || events[0].InvolvedObject.Name != "bare" || events[0].InvolvedObject.UID != "pod-uid" {
+        t.Errorf("expected the event to be on the created pod, got %+v", events[0].InvolvedObject)
+    }
+}
+
+func TestEventOnPodNeverCreated(t *testing.T) {
+    client := fake.NewSimpleClientset()
+    emitter := newEventEmitter(client, 1, 25)
+    emitter.pollInterval, emitter.podTimeout = 10*time.Millisecond, 50*time.Millisecond
+    defer emitter.shutdown()
+
+    emitter.emit(&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare", Namespace: "team-a"}}, mutatedAudit("bare"))
+    err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+        emitter.mutex.Lock()
+        defer emitter.mutex.Unlock()
+        return len(emitter.pending) == 0, nil
+    })
+    if err != nil {
+        t.Fatal("expected the emitter to stop waiting for the pod after its timeout")
+    }
+    waitForEvents(t, client, "team-a", 0)
+}
+
+func TestPendingPodsAreBounded(t *testing.T) {
+    client := fake.NewSimpleClientset()
+    emitter := newEventEmitter(client, 1, 25)
+    defer emitter.shutdown()
+
+    for i := 0; i < maxPendingPods+10; i++ {
+        name := fmt.Sprintf("bare-%d", i)
+        emitter.emit(&core.Pod{ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "team-a"}}, mutatedAudit(name))
+    }
+    emitter.mutex.Lock()
+    pending := len(emitter.pending)
+    emitter.mutex.Unlock()
+    if pending != maxPendingPods {
+        t.Errorf("expected %d pods to be waited for, got %d", maxPendingPods, pending)
+    }
+
+    /* a pod that is already waiting can be admitted again */
+    emitter.emit(&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare-0", Namespace: "team-a"}}, mutatedAudit("bare-0"))
+    created := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare-0", Namespace: "team-a", UID: "pod-uid"}}
+    if _, err := client.CoreV1().Pods("team-a").Create(context.Background(), created, meta.CreateOptions{}); err != nil {
+        t.Fatal(err)
+    }
+    events := waitForEvents(t, client, "team-a", 1)
+    if events[0].InvolvedObject.Name != "bare-0" {
+        t.Errorf("expected the event to be on the created pod, got %+v", events[0].InvolvedObject)
+    }
+}
+
+func TestNoEvents(t *testing.T) {
+    client := fake.NewSimpleClientset(deployment, replicaSet)
+    emitter := newEventEmitter(client, 1, 25)
+    defer emitter.shutdown()
+
+    notAnnotated := &AuditEvent{Namespace: "team-a", Outcome: "skipped", Reason: skippedNotAnnotated}
+    emitter.emit(replicaSetPod(), notAnnotated)
+    dryRun := mutatedAudit("app-5d9c-*")
+    dryRun.DryRun = true
+    emitter.emit(replicaSetPod(), dryRun)
+    waitForEvents(t, client, "team-a", 0)
+}
+
+func TestEventsAreRateLimited(t *testing.T) {
+    client := fake.NewSimpleClientset(deployment, replicaSet)
+    emitter := newEventEmitter(client, 0.001, 3)
+    defer emitter.shutdown()
+
+    for i := 0; i < 10; i++ {
+        emitter.emit(replicaSetPod(), mutatedAudit(fmt.Sprintf("app-5d9c-%d", i)))
+    }
+    waitForEvents(t, client, "team-a", 3)
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "strings"
+    "time"
+
+    admission "k8s.io/api/admission/v1"
+    authentication "k8s.io/api/authentication/v1"
+    authorization "k8s.io/api/authorization/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/klog/v2"
+)
+
+const (
+    /* the label the API server adds to every namespace, which selectors can use */
+    namespaceNameLabel = "kubernetes.io/metadata.name"
+    explainLookupTimeout = 2 * time.Second
+)
+
+// Explanation describes what would happen to a pod when it is created: whether the API server would send it to
+// the webhook, and the decisions mutatePods would make, including the patch and warnings. An explanation is
+// hypothetical if the namespace labels were given rather than looked up in the cluster.
+type Explanation struct {
+    Namespace string `json:"namespace"`
+    Pod string `json:"pod"`
+    Hypothetical bool `json:"hypothetical,omitempty"`
+    Selected bool `json:"selected"`
+    Outcome string `json:"outcome"`
+    Reason string `json:"reason,omitempty"`
+    Message string `json:"message,omitempty"`
+    Steps []ExplainStep `json:"steps"`
+    Warnings []string `json:"warnings,omitempty"`
+    PolicyDecision *PolicyDecision `json:"policyDecision,omitempty"`
+    CredentialMechanism string `json:"credentialMechanism,omitempty"`
+    Patch json.RawMessage `json:"patch,omitempty"`
+}
+
+// ExplainStep is one of the decisions made about a pod, as it would be logged by the admission controller.
+type ExplainStep struct {
+    Level string `json:"level"`
+    Message string `json:"message"`
+    Error string `json:"error,omitempty"`
+    Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// explainTrace collects the steps of an explanation from a requestLogger.
+type explainTrace struct {
+    steps []ExplainStep
+}
+
+func (t *explainTrace) add(level string, msg string, err error, keysAndValues []interface{}) {
+    step := ExplainStep{Level: level, Message: msg}
+    if err != nil {
+        step.Error = err.Error()
+    }
+    for i := 0; i+1 < len(keysAndValues); i += 2 {
+        if step.Details == nil {
+            step.Details = map[string]interface{}{}
+        }
+        value := keysAndValues[i+1]
+        if e, ok := value.(error); ok {
+            value = e.Error()
+        }
+        step.Details[fmt.Sprint(keysAndValues[i])] = value
+    }
+    t.steps = append(t.steps, step)
+}
+
+// ExplainRequest is the body of a request to /explain. The namespace defaults to the pod's namespace, and its
+// labels are looked up if they are not given. The pod cannot be in another namespace.
+type ExplainRequest struct {
+    Namespace string `json:"namespace"`
+    NamespaceLabels map[string]string `json:"namespaceLabels"`
+    Pod runtime.RawExtension `json:"pod"`
+}
+
+// webhookSelectors are the namespace and object selectors of the mutating webhook, which decide whether the API
+// server sends a pod to the webhook at all.
+type webhookSelectors struct {
+    source string
+    namespaceSelector *meta.LabelSelector
+    objectSelector *meta.LabelSelector
+}
+
+// defaultWebhookSelectors are the selectors of the webhook installed by the Helm chart.
+var defaultWebhookSelectors = webhookSelectors{
+    source: "Helm chart defaults",
+    namespaceSelector: &meta.LabelSelector{MatchExpressions: []meta.LabelSelectorRequirement{
+        {Key: "secret-injection", Operator: meta.LabelSelectorOpIn, Values: []string{"enabled"}},
+    }},
+    objectSelector: &meta.LabelSelector{MatchExpressions: []meta.LabelSelectorRequirement{
+        {Key: "secret-injection", Operator: meta.LabelSelectorOpNotIn, Values: []string{"disabled"}},
+    }},
+}
+
+// podWebhookSelectors looks up the selectors of the webhook that calls /mutating-pods in the
+// MutatingWebhookConfiguration named --webhook-name, falling back to the Helm chart's.
+func podWebhookSelectors() webhookSelectors {
+    if clientset == nil {
+        return defaultWebhookSelectors
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), explainLookupTimeout)
+    defer cancel()
+    configuration, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookName, meta.GetOptions{})
+    if err != nil {
+        klog.V(2).InfoS("Unable to look up the webhook configuration, using the Helm chart's selectors", "name", config.WebhookName, "err", err)
+        return defaultWebhookSelectors
+    }
+    for _, webhook := range configuration.Webhooks {
+        service := webhook.ClientConfig.Service
+        if service != nil && service.Path != nil && *service.Path == "/mutating-pods" {
+            return webhookSelectors{
+                source: "MutatingWebhookConfiguration " + configuration.Name,
+                namespaceSelector: webhook.NamespaceSelector,
+                objectSelector: webhook.ObjectSelector,
+            }
+        }
+    }
+    return defaultWebhookSelectors
+}
+
+// selectorMatches checks labels against a webhook selector. As in the API server, a selector that is not set
+// matches everything.
+func selectorMatches(selector *meta.LabelSelector, values map[string]string) (bool, error) {
+    if selector == nil {
+        return true, nil
+    }
+    parsed, err := meta.LabelSelectorAsSelector(selector)
+    if err != nil {
+        return false, err
+    }
+    return parsed.Matches(labels.Set(values)), nil
+}
+
+// explainPod explains what would happen to a pod created in a namespace with the given labels. It goes through
+// the same code as the webhook, without recording metrics, audit events or Kubernetes Events. If hypothetical is
+// set, the labels were given by the caller rather than looked up.
+func explainPod(raw []byte, name string, namespace string, namespaceLabels map[string]string, hypothetical bool, userInfo authentication.UserInfo, selectors webhookSelectors) *Explanation {
+    trace := &explainTrace{}
+    explanation := &Explanation{Namespace: namespace, Pod: name, Hypothetical: hypothetical}
+    defer func() { explanation.Steps = trace.steps }()
+    if hypothetical {
+        trace.add("info", "Namespace labels were given rather than looked up in the cluster, so the explanation is hypothetical", nil, []interface{}{"labels", namespaceLabels})
+    }
+
+    /* the API server only calls the webhook if the namespace and pod match its selectors */
+    values := map[string]string{namespaceNameLabel: namespace}
+    for key, value := range namespaceLabels {
+        values[key] = value
+    }
+    pod := struct {
+        Metadata meta.ObjectMeta `json:"metadata"`
+    }{}
+    if err := json.Unmarshal(raw, &pod); err != nil {
+        trace.add("error", "Unable to decode pod object", err, nil)
+        explanation.Outcome, explanation.Reason, explanation.Message = "denied", deniedInvalidObject, err.Error()
+        return explanation
+    }
+    if name == "" {
+        explanation.Pod = pod.Metadata.Name
+    }
+    for _, check := range []struct {
+        what string
+        field string
+        selector *meta.LabelSelector
+        labels map[string]string
+    }{
+        {"Namespace", "namespaceSelector", selectors.namespaceSelector, values},
+        {"Pod", "objectSelector", selectors.objectSelector, pod.Metadata.Labels},
+    } {
+        selector, _ := json.Marshal(check.selector)
+        details := []interface{}{"selector", json.RawMessage(selector), "labels", check.labels, "source", selectors.source}
+        matches, err := selectorMatches(check.selector, check.labels)
+        if err != nil {
+            trace.add("error", fmt.Sprintf("The webhook's %s is invalid", check.field), err, details)
+        }
+        if !matches {
+            message := fmt.Sprintf("%s labels do not match the webhook's %s, so the API server would not call the webhook and the pod would be created unchanged", check.what, check.field)
+            trace.add("info", message, nil, details)
+            explanation.Outcome, explanation.Reason, explanation.Message = "not_selected", check.field, message
+            return explanation
+        }
+        trace.add("info", fmt.Sprintf("%s labels match the webhook's %s", check.what, check.field), nil, details)
+    }
+    explanation.Selected = true
+
+    /* make the same decisions as for an admission request, as a dry run */
+    request := &admission.AdmissionRequest{
+        UID: types.UID("explain"),
+        Kind: meta.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+        Resource: meta.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"},
+        Name: name,
+        Namespace: namespace,
+        Operation: admission.Create,
+        UserInfo: userInfo,
+        Object: runtime.RawExtension{Raw: raw},
+        DryRun: &True,
+    }
+    audit := newAuditEvent("mutating-pods", request)
+    response := mutatePod(admission.AdmissionReview{Request: request}, requestLogger{trace: trace}, audit, false)
+    explanation.Outcome, explanation.Reason, explanation.Message = audit.Outcome, audit.Reason, audit.Message
+    explanation.Warnings = response.Warnings
+    explanation.CredentialMechanism = audit.CredentialMechanism
+    if audit.PolicyDecision.Policy != decisionNotEvaluated {
+        explanation.PolicyDecision = &audit.PolicyDecision
+    }
+    if len(response.Patch) > 0 {
+        explanation.Patch = response.Patch
+    }
+    return explanation
+}
+
+// serveExplain explains what would happen to a pod, for callers that are allowed to create pods in its namespace.
+func serveExplain(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, fmt.Sprintf("Method %s is not allowed, expect POST", r.Method), http.StatusMethodNotAllowed)
+        return
+    }
+    contentType := r.Header.Get("Content-Type")
+    if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+        http.Error(w, fmt.Sprintf("contentType=%s, expect application/json", contentType), http.StatusUnsupportedMediaType)
+        return
+    }
+    token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if token == "" || token == r.Header.Get("Authorization") {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        http.Error(w, "A bearer token is required", http.StatusUnauthorized)
+        return
+    }
+    if r.Body == nil {
+        http.Error(w, "Request has no body", http.StatusBadRequest)
+        return
+    }
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Request body could not be read: %v", err), http.StatusBadRequest)
+        return
+    }
+    request := ExplainRequest{}
+    if err := json.Unmarshal(body, &request); err != nil {
+        http.Error(w, fmt.Sprintf("Request could not be decoded: %v", err), http.StatusBadRequest)
+        return
+    }
+    if len(request.Pod.Raw) == 0 {
+        http.Error(w, "Request has no pod", http.StatusBadRequest)
+        return
+    }
+    pod := struct {
+        Metadata meta.ObjectMeta `json:"metadata"`
+    }{}
+    if err := json.Unmarshal(request.Pod.Raw, &pod); err != nil {
+        http.Error(w, fmt.Sprintf("Pod could not be decoded: %v", err), http.StatusBadRequest)
+        return
+    }
+    if request.Namespace == "" {
+        request.Namespace = pod.Metadata.Namespace
+    }
+    if request.Namespace == "" {
+        http.Error(w, "Request has no namespace", http.StatusBadRequest)
+        return
+    }
+    if pod.Metadata.Namespace != "" && pod.Metadata.Namespace != request.Namespace {
+        http.Error(w, fmt.Sprintf("Pod namespace %s does not match the request namespace %s", pod.Metadata.Namespace, request.Namespace), http.StatusBadRequest)
+        return
+    }
+
+    userInfo, status, err := authorizeExplain(r.Context(), token, request.Namespace)
+    if err != nil {
+        klog.ErrorS(err, "Rejected explain request", "namespace", request.Namespace, "status", status)
+        http.Error(w, err.Error(), status)
+        return
+    }
+    hypothetical := request.NamespaceLabels != nil
+    if !hypothetical {
+        if request.NamespaceLabels, err = getNamespaceLabels(r.Context(), request.Namespace); err != nil {
+            klog.ErrorS(err, "Unable to look up namespace labels", "namespace", request.Namespace)
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+    }
+    klog.InfoS("Explaining pod", "user", userInfo.Username, "namespace", request.Namespace, "pod", pod.Metadata.Name)
+    explanation := explainPod(request.Pod.Raw, "", request.Namespace, request.NamespaceLabels, hypothetical, userInfo, podWebhookSelectors())
+    responseBytes, err := json.Marshal(explanation)
+    if err != nil {
+        klog.Error(err)
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    if _, err := w.Write(responseBytes); err != nil {
+        klog.Error(err)
+    }
+}
+
+// authorizeExplain authenticates the caller's bearer token with a TokenReview, and checks with a
+// SubjectAccessReview that they can create pods in the namespace. It returns the HTTP status to reply with if
+// they cannot.
+func authorizeExplain(ctx context.Context, token string, namespace string) (authentication.UserInfo, int, error) {
+    ctx, cancel := context.WithTimeout(ctx, explainLookupTimeout)
+    defer cancel()
+    review, err := clientset.AuthenticationV1().TokenReviews().Create(ctx, &authentication.TokenReview{
+        Spec: authentication.TokenReviewSpec{Token: token},
+    }, meta.CreateOptions{})
+    if err != nil {
+        return authentication.UserInfo{}, http.StatusInternalServerError, fmt.Errorf("Unable to authenticate the request: %v", err)
+    }
+    if !review.Status.Authenticated {
+        return authentication.UserInfo{}, http.StatusUnauthorized, fmt.Errorf("The bearer token is not valid")
+    }
+    userInfo := review.Status.User
+    extra := map[string]authorization.ExtraValue{}
+    for key, value := range userInfo.Extra {
+        extra[key] = authorization.ExtraValue(value)
+    }
+    access, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorization.SubjectAccessReview{
+        Spec: authorization.SubjectAccessReviewSpec{
+            ResourceAttributes: &authorization.ResourceAttributes{Namespace: namespace, Verb: "create", Resource: "pods"},
+            User: userInfo.Username,
+            Groups: userInfo.Groups,
+            UID: userInfo.UID,
+            Extra: extra,
+        },
+    }, meta.CreateOptions{})
+    if err != nil {
+        return userInfo, http.StatusInternalServerError, fmt.Errorf("Unable to authorize the request: %v", err)
+    }
+    if !access.Status.Allowed {
+        return userInfo, http.StatusForbidden, fmt.Errorf("User %s cannot create pods in namespace %s, so cannot explain them", userInfo.Username, namespace)
+    }
+    return userInfo, http.StatusOK, nil
+}
+
+// getNamespaceLabels looks up the labels of a namespace. A namespace that does not exist yet has no labels.
+func getNamespaceLabels(ctx context.Context, namespace string) (map[string]string, error) {
+    ctx, cancel := context.WithTimeout(ctx, explainLookupTimeout)
+    defer cancel()
+    ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, meta.GetOptions{})
+    if errors.IsNotFound(err) {
+        return map[string]string{}, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("Unable to look up namespace %s: %v", namespace, err)
+    }
+    return ns.ObjectMeta.Labels, nil
+}
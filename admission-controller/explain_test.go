@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    authentication "k8s.io/api/authentication/v1"
+    authorization "k8s.io/api/authorization/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+const explainPodJSON = `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "app", "namespace": "team-a",
+    "annotations": {"secrets.aws.k8s/injectorWebhook": "init-container",
+        "secrets.aws.k8s/secretArns": "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF"}},
+    "spec": {"containers": [{"name": "app", "image": "app:1"}]}}`
+
+// withExplainClient uses a fake clientset while a test runs. The token "developer" authenticates as a user who
+// can create pods in team-a, and the token "viewer" as one who cannot; other tokens are not valid.
+func withExplainClient(t *testing.T, namespaceLabels map[string]string) {
+    t.Helper()
+    client := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Labels: namespaceLabels}},
+        &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "default", Namespace: "team-a"}})
+    client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        review := action.(k8stesting.CreateAction).GetObject().(*authentication.TokenReview)
+        switch review.Spec.Token {
+        case "developer", "viewer":
+            review.Status.Authenticated = true
+            review.Status.User = authentication.UserInfo{Username: review.Spec.Token, Groups: []string{"system:authenticated"}}
+        }
+        return true, review, nil
+    })
+    client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        review := action.(k8stesting.CreateAction).GetObject().(*authorization.SubjectAccessReview)
+        attributes := review.Spec.ResourceAttributes
+        review.Status.Allowed = review.Spec.User == "developer" && attributes.Namespace == "team-a" &&
+            attributes.Verb == "create" && attributes.Resource == "pods"
+        return true, review, nil
+    })
+    clientset = client
+    t.Cleanup(func() { clientset = nil })
+}
+
+func postExplain(body string, token string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodPost, "/explain", bytes.NewReader([]byte(body)))
+    request.Header.Set("Content-Type", "application/json")
+    if token != "" {
+        request.Header.Set("Authorization", "Bearer "+token)
+    }
+    recorder := httptest.NewRecorder()
+    serveExplain(recorder, request)
+    return recorder
+}
+
+func decodeExplanation(t *testing.T, recorder *httptest.ResponseRecorder) *Explanation {
+    t.Helper()
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("expected HTTP status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+    explanation := &Explanation{}
+    if err := json.Unmarshal(recorder.Body.Bytes(), explanation); err != nil {
+        t.Fatalf("response is not an explanation: %v", err)
+    }
+    return explanation
+}
+
+func TestExplainAuthorization(t *testing.T) {
+    withExplainClient(t, nil)
+    body := `{"pod": ` + explainPodJSON + `}`
+    for token, expected := range map[string]int{"": http.StatusUnauthorized, "expired": http.StatusUnauthorized, "viewer": http.StatusForbidden} {
+        if recorder := postExplain(body, token); recorder.Code != expected {
+            t.Errorf("expected HTTP status %d for token %q, got %d: %s", expected, token, recorder.Code, recorder.Body.String())
+        }
+    }
+    pod := strings.Replace(explainPodJSON, `"namespace": "team-a",`, "", 1)
+    if recorder := postExplain(`{"namespace": "team-b", "pod": `+pod+`}`, "developer"); recorder.Code != http.StatusForbidden {
+        t.Errorf("expected HTTP status %d for another namespace, got %d", http.StatusForbidden, recorder.Code)
+    }
+}
+
+func TestExplainOtherNamespace(t *testing.T) {
+    withExplainClient(t, nil)
+    pod := strings.Replace(explainPodJSON, `"namespace": "team-a",`, `"namespace": "team-b",`, 1)
+    if recorder := postExplain(`{"namespace": "team-a", "pod": `+pod+`}`, "developer"); recorder.Code != http.StatusBadRequest {
+        t.Errorf("expected HTTP status %d for a pod in another namespace, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body.String())
+    }
+    if recorder := postExplain(`{"pod": `+pod+`}`, "developer"); recorder.Code != http.StatusForbidden {
+        t.Errorf("expected HTTP status %d for a pod in a namespace the user cannot create pods in, got %d", http.StatusForbidden, recorder.Code)
+    }
+}
+
+func TestExplainNotSelected(t *testing.T) {
+    withExplainClient(t, map[string]string{"team": "a"})
+    explanation := decodeExplanation(t, postExplain(`{"pod": `+explainPodJSON+`}`, "developer"))
+    if explanation.Selected || explanation.Outcome != "not_selected" || explanation.Reason != "namespaceSelector" {
+        t.Errorf("expected the namespace not to be selected, got %+v", explanation)
+    }
+    if len(explanation.Steps) != 1 || len(explanation.Patch) != 0 || explanation.Hypothetical {
+        t.Errorf("expected a single step and no patch, got %+v", explanation)
+    }
+
+    pod := strings.Replace(explainPodJSON, `"namespace": "team-a",`, `"namespace": "team-a", "labels": {"secret-injection": "disabled"},`, 1)
+    explanation = decodeExplanation(t, postExplain(`{"namespaceLabels": {"secret-injection": "enabled"}, "pod": `+pod+`}`, "developer"))
+    if explanation.Outcome != "not_selected" || explanation.Reason != "objectSelector" || len(explanation.Steps) != 3 {
+        t.Errorf("expected the pod not to be selected, got %+v", explanation)
+    }
+    if !explanation.Hypothetical {
+        t.Error("expected the explanation to be hypothetical when the namespace labels are given")
+    }
+}
+
+func TestExplainMutatedPod(t *testing.T) {
+    withExplainClient(t, map[string]string{"secret-injection": "enabled"})
+    out := withAuditLog(t)
+    mutated := admissionRequests.WithLabelValues("mutating-pods", "mutated", "")
+    before := testutil.ToFloat64(mutated)
+
+    explanation := decodeExplanation(t, postExplain(`{"pod": `+explainPodJSON+`}`, "developer"))
+    if !explanation.Selected || explanation.Outcome != "mutated" || explanation.Namespace != "team-a" || explanation.Pod != "app" {
+        t.Fatalf("expected the pod to be mutated, got %+v", explanation)
+    }
+    if explanation.PolicyDecision == nil || explanation.PolicyDecision.Policy != decisionDisabled {
+        t.Errorf("expected the policy decision, got %+v", explanation.PolicyDecision)
+    }
+    var patch []map[string]interface{}
+    if err := json.Unmarshal(explanation.Patch, &patch); err != nil || len(patch) == 0 {
+        t.Errorf("expected a JSON patch, got %s: %v", explanation.Patch, err)
+    }
+    messages := []string{}
+    for _, step := range explanation.Steps {
+        messages = append(messages, step.Message)
+    }
+    for _, expected := range []string{"Namespace labels match the webhook's namespaceSelector", "Looked up service account", "Service account has no", "Injecting init container", "Patching pod"} {
+        if !strings.Contains(strings.Join(messages, "\n"), expected) {
+            t.Errorf("expected a step %q, got %q", expected, messages)
+        }
+    }
+
+    if out.Len() > 0 {
+        t.Errorf("expected no audit events, got %s", out.String())
+    }
+    if after := testutil.ToFloat64(mutated); after != before {
+        t.Errorf("expected the admission metrics not to change, went from %v to %v", before, after)
+    }
+}
+
+func TestExplainDeniedPod(t *testing.T) {
+    withExplainClient(t, nil)
+    pod := strings.Replace(explainPodJSON, "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF", "not-an-arn", 1)
+    explanation := decodeExplanation(t, postExplain(`{"namespaceLabels": {"secret-injection": "enabled"}, "pod": `+pod+`}`, "developer"))
+    if explanation.Outcome != "denied" || explanation.Message == "" || len(explanation.Patch) != 0 {
+        t.Errorf("expected the pod to be denied, got %+v", explanation)
+    }
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "time"
+)
+
+// WatchedFile reads a configuration file, keeping track of its modification time so that changes (e.g. when
+// the ConfigMap it is mounted from is updated) can be picked up without restarting.
+type WatchedFile struct {
+    path string
+    modTime time.Time
+    read bool
+}
+
+// readIfChanged returns the content of the file and true if the file has changed since it was last read,
+// or nil and false if it has not.
+func (f *WatchedFile) readIfChanged() ([]byte, bool, error) {
+    info, err := os.Stat(f.path)
+    if err != nil {
+        return nil, false, err
+    }
+    if f.read && info.ModTime().Equal(f.modTime) {
+        return nil, false, nil
+    }
+    data, err := ioutil.ReadFile(f.path)
+    if err != nil {
+        return nil, false, err
+    }
+    f.modTime = info.ModTime()
+    f.read = true
+    return data, true, nil
+}
@@ -3,7 +3,14 @@ module github.com/ecrousseau/aws-secret-injector/admission-controller
 go 1.15
 
 require (
+	github.com/evanphx/json-patch v4.9.0+incompatible
+	github.com/go-logr/logr v0.4.0
+	github.com/google/cel-go v0.9.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v1.11.1
 	k8s.io/api v0.20.2
 	k8s.io/apimachinery v0.20.2
+	k8s.io/client-go v0.20.2
 	k8s.io/klog/v2 v2.5.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,435 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+
+    admission "k8s.io/api/admission/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+// Exit codes of the lint command.
+const (
+    lintOK = 0
+    lintFailed = 1
+    lintInvalid = 2
+)
+
+const lintUsage = `Usage: admission-controller lint [flags] [path ...]
+
+Checks the secret injection annotations of the Pods and workloads (Deployments, StatefulSets, DaemonSets,
+ReplicaSets, Jobs and CronJobs) in Kubernetes manifests, in the same way as the admission controller does when
+their pods are created. Directories are searched for .yaml, .yml and .json files; - reads stdin, e.g. the output
+of kustomize build. Files and directories whose names start with . are skipped, as are documents that are not
+Kubernetes objects.
+
+Namespaces and service accounts are not looked up, so their annotations (e.g. secrets.aws.k8s/region and
+eks.amazonaws.com/role-arn) are not taken into account.
+
+Exit status is 0 if there are no findings at the --fail-on level or above, 1 if there are and 2 if the flags
+are invalid or a file cannot be read.
+
+Flags:
+`
+
+// lintRule is a kind of problem that the lint command reports.
+type lintRule struct {
+    id string
+    description string
+}
+
+var lintRules = []lintRule{
+    {"invalid-manifest", "The manifest is not valid YAML or JSON, or its pod template cannot be decoded."},
+    {"invalid-annotations", "The secret injection annotations are invalid, so the pod would be denied."},
+    {"annotation-warning", "The secret injection annotations have a problem that does not prevent injection, e.g. an unknown annotation."},
+    {"init-container-conflict", "The pod already has an init container named secrets-init-container, so it would be denied."},
+    {"region-not-configured", "No AWS region is configured for secrets listed by name."},
+    {"secret-access-policy", "The secret access policy does not allow the secrets for the namespace and service account."},
+    {"secret-injection-rules", "A secret injection rule failed for one of the secrets."},
+    {"credentials", "The init container's AWS credentials cannot be determined, or are ambiguous."},
+    {"secret-volume", "The pod already has a volume named secret-vol, which the secrets will be written to."},
+    {"lookup-failed", "The pod's namespace or service account could not be looked up."},
+    {"internal-error", "The pod could not be checked, e.g. because the secret access policy could not be loaded."},
+}
+
+// lintDenialRules are the rules that report why mutatePod would deny a pod. Anything else is an internal-error.
+var lintDenialRules = map[string]string{
+    deniedInvalidObject: "invalid-manifest",
+    deniedInvalidAnnotations: "invalid-annotations",
+    deniedInitContainerConflict: "init-container-conflict",
+    deniedPolicy: "secret-access-policy",
+    deniedRule: "secret-injection-rules",
+    deniedCredentials: "credentials",
+    deniedLookupFailed: "lookup-failed",
+}
+
+// lintWarningRules are the rules that report the warnings mutatePod would return, by the check they come from.
+var lintWarningRules = map[string]string{
+    warnedAnnotations: "annotation-warning",
+    warnedRegion: "region-not-configured",
+    warnedRule: "secret-injection-rules",
+    warnedCredentials: "credentials",
+    warnedSecretVolume: "secret-volume",
+}
+
+// Levels of lint findings, as in SARIF.
+const (
+    lintError = "error"
+    lintWarning = "warning"
+)
+
+// LintFinding is a problem found in a manifest.
+type LintFinding struct {
+    RuleID string `json:"ruleId"`
+    Level string `json:"level"`
+    File string `json:"file"`
+    Line int `json:"line"`
+    Kind string `json:"kind,omitempty"`
+    Namespace string `json:"namespace,omitempty"`
+    Name string `json:"name,omitempty"`
+    Message string `json:"message"`
+}
+
+// lintOptions are the settings of the lint command.
+type lintOptions struct {
+    namespace string
+    username string
+    groups string
+    format string
+    failOn string
+    verbose bool
+}
+
+// runLint runs the lint command with its command line arguments, returning the exit status.
+func runLint(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    options := lintOptions{}
+    flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    flags.Usage = func() {
+        fmt.Fprint(stderr, lintUsage)
+        flags.PrintDefaults()
+    }
+    flags.StringVar(&options.namespace, "namespace", "default",
+        "Namespace of objects that do not set one.")
+    flags.StringVar(&options.username, "username", "lint",
+        "User the objects are created by, for the secret injection rules.")
+    flags.StringVar(&options.groups, "groups", "system:authenticated",
+        "Comma-separated list of the groups of the user the objects are created by.")
+    flags.StringVar(&options.format, "format", "text",
+        "Output format: text, json or sarif.")
+    flags.StringVar(&options.failOn, "fail-on", lintError,
+        "Lowest level of finding that makes the exit status 1: error or warning.")
+    flags.BoolVar(&options.verbose, "v", false,
+        "Log how each pod is handled to stderr, as the admission controller does.")
+    flags.StringVar(&config.DefaultRegion, "default-region", config.DefaultRegion,
+        "AWS region for secrets listed by name, when the pod has no secrets.aws.k8s/region annotation.")
+    flags.StringVar(&config.PolicyFile, "policy-file", config.PolicyFile,
+        "File containing the secret access policy. If not set, pods may request any secret.")
+    flags.StringVar(&config.RulesFile, "rules-file", config.RulesFile,
+        "File containing CEL rules that are evaluated for each secret a pod requests.")
+    if err := flags.Parse(args); err != nil {
+        return lintInvalid
+    }
+    if options.format != "text" && options.format != "json" && options.format != "sarif" {
+        fmt.Fprintf(stderr, "Unsupported output format %q (expected text, json or sarif)\n", options.format)
+        return lintInvalid
+    }
+    if options.failOn != lintError && options.failOn != lintWarning {
+        fmt.Fprintf(stderr, "Unsupported --fail-on level %q (expected error or warning)\n", options.failOn)
+        return lintInvalid
+    }
+    if err := setupCommand(options.verbose); err != nil {
+        fmt.Fprintln(stderr, err)
+        return lintInvalid
+    }
+
+    paths := flags.Args()
+    if len(paths) == 0 {
+        paths = []string{"-"}
+    }
+    findings := []LintFinding{}
+    for _, path := range paths {
+        files, err := manifestFiles(path)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            return lintInvalid
+        }
+        for _, file := range files {
+            fileFindings, err := lintFile(file, stdin, options)
+            if err != nil {
+                fmt.Fprintln(stderr, err)
+                return lintInvalid
+            }
+            findings = append(findings, fileFindings...)
+        }
+    }
+
+    if err := writeFindings(stdout, findings, options.format); err != nil {
+        fmt.Fprintln(stderr, err)
+        return lintInvalid
+    }
+    for _, finding := range findings {
+        if finding.Level == lintError || options.failOn == lintWarning {
+            return lintFailed
+        }
+    }
+    return lintOK
+}
+
+// manifestFiles finds the manifest files in a directory, in lexical order. Other paths are returned as they are.
+func manifestFiles(path string) ([]string, error) {
+    if path == "-" {
+        return []string{path}, nil
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, fmt.Errorf("Unable to read manifests: %v", err)
+    }
+    if !info.IsDir() {
+        return []string{path}, nil
+    }
+    var files []string
+    err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if file != path && strings.HasPrefix(info.Name(), ".") {
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        switch strings.ToLower(filepath.Ext(file)) {
+        case ".yaml", ".yml", ".json":
+            if !info.IsDir() {
+                files = append(files, file)
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("Unable to read manifests: %v", err)
+    }
+    return files, nil
+}
+
+// lintFile checks the objects in a manifest file. A file that is not valid YAML is a finding rather than an
+// error, so that the other files are still checked.
+func lintFile(path string, stdin io.Reader, options lintOptions) ([]LintFinding, error) {
+    documents, err := readManifestFile(path, stdin)
+    var invalid *manifestError
+    if errors.As(err, &invalid) {
+        return []LintFinding{{RuleID: "invalid-manifest", Level: lintError, File: path, Line: invalid.line, Message: invalid.err.Error()}}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var findings []LintFinding
+    for _, document := range documents {
+        findings = append(findings, lintObject(document, document.data, options)...)
+    }
+    return findings, nil
+}
+
+// lintObject checks the pod or pod template of an object, or of each object in a List. Objects without a kind
+// are not Kubernetes objects (e.g. Helm values files), and other kinds have no pods, so they are skipped.
+func lintObject(document manifestDocument, data []byte, options lintOptions) []LintFinding {
+    object := struct {
+        Kind string `json:"kind"`
+        Metadata struct {
+            Name string `json:"name"`
+            Namespace string `json:"namespace"`
+        } `json:"metadata"`
+        Items []json.RawMessage `json:"items"`
+    }{}
+    if err := json.Unmarshal(data, &object); err != nil {
+        return nil
+    }
+    if strings.HasSuffix(object.Kind, "List") {
+        /* point the findings at the item they are about, if the items can be found in the text */
+        itemDocuments := document.listItems()
+        var findings []LintFinding
+        for i, item := range object.Items {
+            itemDocument := document
+            if len(itemDocuments) == len(object.Items) {
+                itemDocument = itemDocuments[i]
+            }
+            findings = append(findings, lintObject(itemDocument, item, options)...)
+        }
+        return findings
+    }
+    namespace := object.Metadata.Namespace
+    if namespace == "" {
+        namespace = options.namespace
+    }
+
+    pod := core.Pod{}
+    if object.Kind == "Pod" {
+        if err := json.Unmarshal(data, &pod); err != nil {
+            return []LintFinding{{RuleID: "invalid-manifest", Level: lintError, File: document.path, Line: document.line,
+                Kind: object.Kind, Namespace: namespace, Name: object.Metadata.Name, Message: fmt.Sprintf("Pod cannot be decoded: %v", err)}}
+        }
+    } else if _, ok := podTemplatePaths[object.Kind]; ok {
+        template, err := getPodTemplate(object.Kind, data)
+        if err != nil {
+            return []LintFinding{{RuleID: "invalid-manifest", Level: lintError, File: document.path, Line: document.line,
+                Kind: object.Kind, Namespace: namespace, Name: object.Metadata.Name, Message: fmt.Sprintf("Pod template cannot be decoded: %v", err)}}
+        }
+        pod = core.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+    } else {
+        return nil
+    }
+    pod.ObjectMeta.Namespace = namespace
+
+    findings := lintPod(pod, object.Metadata.Name, namespace, options)
+    for i := range findings {
+        findings[i].File, findings[i].Line = document.path, document.lineOf(annotationPrefix)
+        findings[i].Kind, findings[i].Namespace, findings[i].Name = object.Kind, namespace, object.Metadata.Name
+    }
+    return findings
+}
+
+// lintPod checks a pod with mutatePod, as a dry run that is not recorded, returning findings with only the
+// rule, level and message set.
+func lintPod(pod core.Pod, name string, namespace string, options lintOptions) []LintFinding {
+    raw, err := json.Marshal(pod)
+    if err != nil {
+        return []LintFinding{{RuleID: "internal-error", Level: lintError, Message: err.Error()}}
+    }
+    request := &admission.AdmissionRequest{
+        UID: types.UID("lint"),
+        Kind: meta.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+        Resource: meta.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"},
+        Name: name,
+        Namespace: namespace,
+        Operation: admission.Create,
+        UserInfo: commandUser(options.username, options.groups),
+        Object: runtime.RawExtension{Raw: raw},
+        DryRun: &True,
+    }
+    audit := newAuditEvent("mutating-pods", request)
+    response := mutatePod(admission.AdmissionReview{Request: request}, newRequestLogger(request), audit, false)
+
+    var findings []LintFinding
+    for _, warning := range response.Warnings {
+        ruleID, ok := lintWarningRules[audit.warningReasons[warning]]
+        if !ok {
+            ruleID = "internal-error"
+        }
+        findings = append(findings, LintFinding{RuleID: ruleID, Level: lintWarning, Message: warning})
+    }
+    if !response.Allowed {
+        ruleID, ok := lintDenialRules[audit.Reason]
+        if !ok {
+            ruleID = "internal-error"
+        }
+        findings = append(findings, LintFinding{RuleID: ruleID, Level: lintError, Message: audit.Message})
+    }
+    return findings
+}
+
+// writeFindings writes the findings as text, as a JSON array or as a SARIF log.
+func writeFindings(out io.Writer, findings []LintFinding, format string) error {
+    switch format {
+    case "json":
+        data, err := json.MarshalIndent(findings, "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(out, string(data))
+        return err
+    case "sarif":
+        data, err := json.MarshalIndent(sarifLog(findings), "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(out, string(data))
+        return err
+    }
+    for _, finding := range findings {
+        object := finding.Kind + "/" + finding.Name
+        if finding.Kind == "" {
+            object = "-"
+        }
+        if _, err := fmt.Fprintf(out, "%s:%d: %s: %s: %s (%s)\n", finding.File, finding.Line, finding.Level, object, finding.Message, finding.RuleID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// sarifLog converts findings to a SARIF 2.1.0 log, e.g. for GitHub code scanning.
+func sarifLog(findings []LintFinding) map[string]interface{} {
+    rules := make([]interface{}, 0, len(lintRules))
+    ruleIndex := map[string]int{}
+    for i, rule := range lintRules {
+        ruleIndex[rule.id] = i
+        rules = append(rules, map[string]interface{}{
+            "id": rule.id,
+            "shortDescription": map[string]string{"text": rule.description},
+        })
+    }
+    results := make([]interface{}, 0, len(findings))
+    for _, finding := range findings {
+        message := finding.Message
+        if finding.Kind != "" {
+            message = fmt.Sprintf("%s %s: %s", finding.Kind, finding.Name, finding.Message)
+        }
+        uri := filepath.ToSlash(finding.File)
+        if uri == "-" {
+            uri = "stdin"
+        }
+        results = append(results, map[string]interface{}{
+            "ruleId": finding.RuleID,
+            "ruleIndex": ruleIndex[finding.RuleID],
+            "level": finding.Level,
+            "message": map[string]string{"text": message},
+            "locations": []interface{}{map[string]interface{}{
+                "physicalLocation": map[string]interface{}{
+                    "artifactLocation": map[string]string{"uri": uri},
+                    "region": map[string]int{"startLine": finding.Line},
+                },
+            }},
+        })
+    }
+    return map[string]interface{}{
+        "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+        "version": "2.1.0",
+        "runs": []interface{}{map[string]interface{}{
+            "tool": map[string]interface{}{
+                "driver": map[string]interface{}{
+                    "name": "aws-secret-injector",
+                    "informationUri": "https://github.com/ecrousseau/aws-secret-injector",
+                    "version": version,
+                    "rules": rules,
+                },
+            },
+            "results": results,
+        }},
+    }
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/klog/v2"
+)
+
+const lintPods = `# pods with problems
+apiVersion: v1
+kind: Pod
+metadata:
+  name: bad-arn
+  annotations:
+    secrets.aws.k8s/injectorWebhook: init-container
+    secrets.aws.k8s/secretArns: arn:aws:secretsmanager:us-east-1:12345:secret:db
+spec:
+  containers:
+  - name: app
+    image: app:1
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: typo
+  namespace: team-b
+  annotations:
+    secrets.aws.k8s/injectorWebhook: init-container
+    secrets.aws.k8s/secretNames: db
+    secrets.aws.k8s/explodejsonkeys: "true"
+spec:
+  containers:
+  - name: app
+    image: app:1
+`
+
+// writeLintFiles creates a directory of manifests to lint.
+func writeLintFiles(t *testing.T, files map[string]string) string {
+    t.Helper()
+    dir, err := ioutil.TempDir("", "lint")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, content := range files {
+        path := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+            t.Fatal(err)
+        }
+        if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return dir
+}
+
+// lint runs the lint command, returning its exit status and stdout.
+func lint(t *testing.T, args ...string) (int, string) {
+    t.Helper()
+    saved := config
+    defer func() {
+        config = saved
+        policyFile, rulesFile = nil, nil
+        offline = false
+        klog.SetLogger(nil)
+    }()
+    var stdout, stderr bytes.Buffer
+    status := runLint(args, strings.NewReader(renderManifests), &stdout, &stderr)
+    if stderr.Len() > 0 {
+        t.Logf("stderr: %s", stderr.String())
+    }
+    return status, stdout.String()
+}
+
+func TestLintDirectory(t *testing.T) {
+    dir := writeLintFiles(t, map[string]string{
+        "apps/pods.yaml": lintPods,
+        "apps/deployment.yml": renderManifests,
+        "broken.yaml": "data: [\n",
+        "values.yaml": "replicas: 2\n",
+        ".git/ignored.yaml": "data: [\n",
+        "README.md": "not a manifest",
+    })
+    defer os.RemoveAll(dir)
+
+    status, stdout := lint(t, "-format", "json", "-default-region", "us-east-1", dir)
+    if status != lintFailed {
+        t.Errorf("expected exit status %d, got %d", lintFailed, status)
+    }
+    var findings []LintFinding
+    if err := json.Unmarshal([]byte(stdout), &findings); err != nil {
+        t.Fatalf("output is not a JSON array of findings: %v\n%s", err, stdout)
+    }
+    expected := []LintFinding{
+        {RuleID: "invalid-annotations", Level: lintError, File: filepath.Join(dir, "apps/pods.yaml"), Line: 7, Kind: "Pod", Namespace: "default", Name: "bad-arn"},
+        {RuleID: "annotation-warning", Level: lintWarning, File: filepath.Join(dir, "apps/pods.yaml"), Line: 20, Kind: "Pod", Namespace: "team-b", Name: "typo"},
+        {RuleID: "invalid-manifest", Level: lintError, File: filepath.Join(dir, "broken.yaml"), Line: 1},
+    }
+    if len(findings) != len(expected) {
+        t.Fatalf("expected %d findings, got %+v", len(expected), findings)
+    }
+    for i, finding := range findings {
+        if finding.Message == "" {
+            t.Errorf("expected finding %d to have a message", i)
+        }
+        finding.Message = ""
+        if finding != expected[i] {
+            t.Errorf("expected finding %d to be %+v, got %+v", i, expected[i], finding)
+        }
+    }
+    if !strings.Contains(findings[1].Message, "did you mean secrets.aws.k8s/explodeJsonKeys?") {
+        t.Errorf("expected a suggestion for the misspelt annotation, got %q", findings[1].Message)
+    }
+}
+
+func TestLintStdin(t *testing.T) {
+    if status, stdout := lint(t, "-default-region", "us-east-1", "-"); status != lintOK || stdout != "" {
+        t.Errorf("expected no findings, got %d: %s", status, stdout)
+    }
+    status, stdout := lint(t)
+    if status != lintOK || !strings.Contains(stdout, "-:22: warning: Deployment/app: No AWS region is configured") {
+        t.Errorf("expected a warning about the region, got %d: %s", status, stdout)
+    }
+    if status, _ := lint(t, "-fail-on", "warning"); status != lintFailed {
+        t.Errorf("expected exit status %d with -fail-on warning, got %d", lintFailed, status)
+    }
+}
+
+func TestLintPolicy(t *testing.T) {
+    dir := writeLintFiles(t, map[string]string{
+        "policy.yaml": "rules:\n- name: team-a\n  namespaces: [team-a]\n  secretNames: [team-a/*]\n",
+    })
+    defer os.RemoveAll(dir)
+
+    status, stdout := lint(t, "-default-region", "us-east-1", "-policy-file", filepath.Join(dir, "policy.yaml"))
+    if status != lintFailed || !strings.Contains(stdout, "error: Deployment/app: ") || !strings.Contains(stdout, "(secret-access-policy)") {
+        t.Errorf("expected the policy to deny the secret, got %d: %s", status, stdout)
+    }
+}
+
+func TestLintSARIF(t *testing.T) {
+    dir := writeLintFiles(t, map[string]string{"pods.yaml": lintPods})
+    defer os.RemoveAll(dir)
+
+    _, stdout := lint(t, "-format", "sarif", "-default-region", "us-east-1", filepath.Join(dir, "pods.yaml"))
+    var log struct {
+        Version string `json:"version"`
+        Runs []struct {
+            Tool struct {
+                Driver struct {
+                    Name string `json:"name"`
+                    Rules []struct {
+                        ID string `json:"id"`
+                    } `json:"rules"`
+                } `json:"driver"`
+            } `json:"tool"`
+            Results []struct {
+                RuleID string `json:"ruleId"`
+                RuleIndex int `json:"ruleIndex"`
+                Level string `json:"level"`
+                Locations []struct {
+                    PhysicalLocation struct {
+                        ArtifactLocation struct {
+                            URI string `json:"uri"`
+                        } `json:"artifactLocation"`
+                        Region struct {
+                            StartLine int `json:"startLine"`
+                        } `json:"region"`
+                    } `json:"physicalLocation"`
+                } `json:"locations"`
+            } `json:"results"`
+        } `json:"runs"`
+    }
+    if err := json.Unmarshal([]byte(stdout), &log); err != nil {
+        t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+    }
+    if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "aws-secret-injector" {
+        t.Fatalf("unexpected SARIF log: %s", stdout)
+    }
+    run := log.Runs[0]
+    if len(run.Results) != 2 {
+        t.Fatalf("expected 2 results, got %d: %s", len(run.Results), stdout)
+    }
+    for _, result := range run.Results {
+        if run.Tool.Driver.Rules[result.RuleIndex].ID != result.RuleID {
+            t.Errorf("result for %s has rule index %d", result.RuleID, result.RuleIndex)
+        }
+        if len(result.Locations) != 1 || !strings.HasSuffix(result.Locations[0].PhysicalLocation.ArtifactLocation.URI, "/pods.yaml") {
+            t.Errorf("unexpected locations for %s: %+v", result.RuleID, result.Locations)
+        }
+    }
+    if run.Results[0].Level != "error" || run.Results[0].Locations[0].PhysicalLocation.Region.StartLine != 7 {
+        t.Errorf("expected an error on line 7, got %+v", run.Results[0])
+    }
+}
+
+const lintList = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: first
+    annotations:
+      secrets.aws.k8s/injectorWebhook: init-container
+      secrets.aws.k8s/secretArns: db
+  spec:
+    containers:
+    - name: app
+      image: app:1
+# the second pod has a typo
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: second
+    annotations:
+      secrets.aws.k8s/injectorWebhook: init-container
+      secrets.aws.k8s/secretArns: arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF
+      secrets.aws.k8s/explodejsonkeys: "true"
+  spec:
+    containers:
+    - name: app
+      image: app:1
+    volumes:
+    - name: secret-vol
+      emptyDir: {}
+metadata:
+  resourceVersion: ""
+`
+
+func TestLintList(t *testing.T) {
+    dir := writeLintFiles(t, map[string]string{"list.yaml": lintList})
+    defer os.RemoveAll(dir)
+
+    _, stdout := lint(t, "-format", "json", filepath.Join(dir, "list.yaml"))
+    var findings []LintFinding
+    if err := json.Unmarshal([]byte(stdout), &findings); err != nil {
+        t.Fatalf("output is not a JSON array of findings: %v\n%s", err, stdout)
+    }
+    expected := []struct {
+        ruleID string
+        line int
+        name string
+    }{
+        {"invalid-annotations", 9, "first"},
+        {"annotation-warning", 21, "second"},
+        {"secret-volume", 21, "second"},
+    }
+    if len(findings) != len(expected) {
+        t.Fatalf("expected %d findings, got %+v", len(expected), findings)
+    }
+    for i, finding := range findings {
+        if finding.RuleID != expected[i].ruleID || finding.Line != expected[i].line || finding.Name != expected[i].name {
+            t.Errorf("expected %s on line %d for pod %s, got %+v", expected[i].ruleID, expected[i].line, expected[i].name, finding)
+        }
+    }
+}
+
+func TestLintRules(t *testing.T) {
+    known := map[string]bool{}
+    for _, rule := range lintRules {
+        known[rule.id] = true
+    }
+    for _, reason := range []string{warnedAnnotations, warnedRegion, warnedRule, warnedCredentials, warnedSecretVolume} {
+        if ruleID, ok := lintWarningRules[reason]; !ok || !known[ruleID] {
+            t.Errorf("expected a lint rule for warnings from %s, got %q", reason, ruleID)
+        }
+    }
+    for _, reason := range []string{deniedLookupFailed, deniedCredentials, deniedPolicy, deniedRule} {
+        if _, ok := lintDenialRules[reason]; !ok {
+            t.Errorf("expected a lint rule for denials because of %s", reason)
+        }
+    }
+    for reason, ruleID := range lintDenialRules {
+        if !known[ruleID] {
+            t.Errorf("denials because of %s are reported under unknown rule %s", reason, ruleID)
+        }
+    }
+}
+
+func TestLintWarningRule(t *testing.T) {
+    saved := config
+    defer func() {
+        config = saved
+        offline = false
+    }()
+    config.DefaultRegion = ""
+    offline = true
+    pod := core.Pod{
+        ObjectMeta: meta.ObjectMeta{Name: "app", Annotations: map[string]string{
+            "secrets.aws.k8s/injectorWebhook": "init-container",
+            "secrets.aws.k8s/secretNames": "team-a/db",
+        }},
+        Spec: core.PodSpec{Containers: []core.Container{{Name: "app", Image: "app:1"}}},
+    }
+    findings := lintPod(pod, "app", "team-a", lintOptions{})
+    if len(findings) != 1 || findings[0].RuleID != "region-not-configured" || findings[0].Message != noRegionWarning {
+        t.Errorf("expected the missing region to be reported under region-not-configured, got %+v", findings)
+    }
+}
+
+func TestLintInvalid(t *testing.T) {
+    if status, _ := lint(t, "-format", "xml"); status != lintInvalid {
+        t.Errorf("expected exit status %d for an unsupported format, got %d", lintInvalid, status)
+    }
+    if status, _ := lint(t, "does-not-exist"); status != lintInvalid {
+        t.Errorf("expected exit status %d for a missing path, got %d", lintInvalid, status)
+    }
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "sync"
+    "time"
+
+    "github.com/go-logr/logr"
+    admission "k8s.io/api/admission/v1"
+    "k8s.io/klog/v2"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+    /* values that look like credentials, wherever they appear in a log message */
+    credentialPatterns = []*regexp.Regexp{
+        regexp.MustCompile(`\b(AKIA|ASIA)[A-Z0-9]{16}\b`),
+        regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+        regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9+/=_.~-]{8,}`),
+        regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`),
+    }
+    /* credentials that are assigned to a key, e.g. password=... or "aws_secret_access_key": "..." - the key is kept */
+    credentialAssignment = regexp.MustCompile(`(?i)((?:secret_?access_?key|session_?token|password|passwd|api_?key|token)["']?\s*[:=]\s*["']?)([^\s"',}]+)`)
+    /* structured log fields and JSON keys whose values are always redacted */
+    credentialKey = regexp.MustCompile(`(?i)(secret_?access_?key|session_?token|password|passwd|api_?key|private_?key|token)$`)
+    /* patterns of the annotations whose values are redacted, from --redact-annotations */
+    redactedAnnotations wildcardPatterns
+)
+
+// loggedJSON is a JSON document in a structured log message, e.g. an admission request. It is redacted by the
+// log filter, and embedded as is in JSON log messages.
+type loggedJSON []byte
+
+func (j loggedJSON) String() string {
+    return string(j)
+}
+
+func (j loggedJSON) MarshalJSON() ([]byte, error) {
+    if !json.Valid(j) {
+        return json.Marshal(string(j))
+    }
+    return j, nil
+}
+
+// setupLogging switches klog to the given format (text or json) and redacts its messages.
+func setupLogging(format string, annotationPatterns []string) error {
+    redactedAnnotations = compileWildcards(annotationPatterns)
+    switch format {
+    case "text":
+    case "json":
+        klog.SetLogger(newJSONLogger(os.Stderr))
+    default:
+        return fmt.Errorf("Unsupported log format %q (expected text or json)", format)
+    }
+    klog.SetLogFilter(redactingFilter{})
+    return nil
+}
+
+// requestLogger writes structured log messages about an admission request, with fields identifying the request.
+// When a request is being explained, the messages are added to the explanation's trace instead.
+type requestLogger struct {
+    fields []interface{}
+    trace *explainTrace
+}
+
+func newRequestLogger(request *admission.AdmissionRequest) requestLogger {
+    return requestLogger{fields: []interface{}{"uid", request.UID, "namespace", request.Namespace}}
+}
+
+// withValues returns a logger that adds more fields, e.g. the name of the pod once it has been decoded.
+func (l requestLogger) withValues(keysAndValues ...interface{}) requestLogger {
+    return requestLogger{fields: l.with(keysAndValues), trace: l.trace}
+}
+
+func (l requestLogger) with(keysAndValues []interface{}) []interface{} {
+    fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+    return append(append(fields, l.fields...), keysAndValues...)
+}
+
+func (l requestLogger) info(msg string, keysAndValues ...interface{}) {
+    if l.trace != nil {
+        l.trace.add("info", msg, nil, keysAndValues)
+        return
+    }
+    klog.InfoSDepth(1, msg, l.with(keysAndValues)...)
+}
+
+// warning logs a warning that is also returned to the client.
+func (l requestLogger) warning(warning string) {
+    if l.trace != nil {
+        l.trace.add("warning", warning, nil, nil)
+        return
+    }
+    klog.InfoSDepth(1, "Returning warning", l.with([]interface{}{"warning", warning})...)
+}
+
+func (l requestLogger) error(err error, msg string, keysAndValues ...interface{}) {
+    if l.trace != nil {
+        l.trace.add("error", msg, err, keysAndValues)
+        return
+    }
+    if err != nil {
+        err = redactedError{err}
+    }
+    klog.ErrorSDepth(1, err, msg, l.with(keysAndValues)...)
+}
+
+// redactedError redacts credentials from the message of an error logged with klog.ErrorS, which does not go
+// through the log filter.
+type redactedError struct {
+    error
+}
+
+func (e redactedError) Error() string {
+    return redactString(e.error.Error())
+}
+
+// redactingFilter is a klog.LogFilter that removes env values, configured annotation values and anything that
+// looks like a credential from log messages.
+type redactingFilter struct{}
+
+func (redactingFilter) Filter(args []interface{}) []interface{} {
+    filtered := make([]interface{}, len(args))
+    for i, arg := range args {
+        filtered[i] = redactValue("", arg)
+    }
+    return filtered
+}
+
+func (f redactingFilter) FilterF(format string, args []interface{}) (string, []interface{}) {
+    return format, f.Filter(args)
+}
+
+func (redactingFilter) FilterS(msg string, keysAndValues []interface{}) (string, []interface{}) {
+    filtered := make([]interface{}, len(keysAndValues))
+    for i, value := range keysAndValues {
+        key := ""
+        if i%2 == 1 {
+            key, _ = keysAndValues[i-1].(string)
+        }
+        filtered[i] = redactValue(key, value)
+    }
+    return redactString(msg), filtered
+}
+
+// redactValue redacts a log message argument or structured log field.
+func redactValue(key string, value interface{}) interface{} {
+    switch v := value.(type) {
+    case string:
+        if key != "" && credentialKey.MatchString(key) {
+            return redacted
+        }
+        return redactString(v)
+    case []byte:
+        return redactJSON(v)
+    case loggedJSON:
+        return loggedJSON(redactJSON(v))
+    case map[string]string:
+        return redactAnnotations(v)
+    case redactedError:
+        return v
+    case error:
+        return redactedError{v}
+    }
+    return value
+}
+
+// redactString replaces anything that looks like a credential.
+func redactString(value string) string {
+    for _, pattern := range credentialPatterns {
+        value = pattern.ReplaceAllString(value, redacted)
+    }
+    return credentialAssignment.ReplaceAllString(value, "${1}"+redacted)
+}
+
+// redactAnnotations returns a copy of the annotations, with the values of the configured annotations redacted.
+func redactAnnotations(annotations map[string]string) map[string]string {
+    if annotations == nil {
+        return nil
+    }
+    result := make(map[string]string, len(annotations))
+    for name, value := range annotations {
+        result[name] = redactAnnotation(name, value)
+    }
+    return result
+}
+
+func redactAnnotation(name string, value string) string {
+    if redactedAnnotations.matches(name) {
+        return redacted
+    }
+    return redactString(value)
+}
+
+// redactJSON redacts a JSON document, such as an admission request or a patch: the values of env vars, the
+// configured annotations and any field that looks like a credential. Anything that is not JSON is redacted as a
+// string.
+func redactJSON(data []byte) []byte {
+    var document interface{}
+    if err := json.Unmarshal(data, &document); err != nil {
+        return []byte(redactString(string(data)))
+    }
+    redactedDocument, err := json.Marshal(redactJSONValue("", document))
+    if err != nil {
+        return []byte(redacted)
+    }
+    return redactedDocument
+}
+
+func redactJSONValue(key string, value interface{}) interface{} {
+    switch v := value.(type) {
+    case map[string]interface{}:
+        for k, item := range v {
+            switch items := item.(type) {
+            case map[string]interface{}:
+                if k == "annotations" {
+                    for name, annotation := range items {
+                        if s, ok := annotation.(string); ok {
+                            items[name] = redactAnnotation(name, s)
+                        }
+                    }
+                    continue
+                }
+            case []interface{}:
+                if k == "env" {
+                    for _, env := range items {
+                        if envVar, ok := env.(map[string]interface{}); ok && envVar["value"] != nil {
+                            envVar["value"] = redacted
+                        }
+                    }
+                }
+            }
+            v[k] = redactJSONValue(k, item)
+        }
+        return v
+    case []interface{}:
+        for i, item := range v {
+            v[i] = redactJSONValue(key, item)
+        }
+        return v
+    case string:
+        if credentialKey.MatchString(key) {
+            return redacted
+        }
+        return redactString(v)
+    }
+    return value
+}
+
+// jsonLogger is a logr.Logger that klog sends its messages to when --log-format=json, writing one JSON object
+// per line with the time, level, message and structured fields.
+type jsonLogger struct {
+    mutex *sync.Mutex
+    out io.Writer
+    name string
+    verbosity int
+    values []interface{}
+}
+
+func newJSONLogger(out io.Writer) logr.Logger {
+    return jsonLogger{mutex: &sync.Mutex{}, out: out}
+}
+
+func (l jsonLogger) Enabled() bool {
+    return true
+}
+
+func (l jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+    l.write("info", nil, msg, keysAndValues)
+}
+
+func (l jsonLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+    l.write("error", err, msg, keysAndValues)
+}
+
+func (l jsonLogger) V(level int) logr.Logger {
+    l.verbosity += level
+    return l
+}
+
+func (l jsonLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+    l.values = append(append([]interface{}{}, l.values...), keysAndValues...)
+    return l
+}
+
+func (l jsonLogger) WithName(name string) logr.Logger {
+    if l.name != "" {
+        name = l.name + "." + name
+    }
+    l.name = name
+    return l
+}
+
+func (l jsonLogger) write(level string, err error, msg string, keysAndValues []interface{}) {
+    var line bytes.Buffer
+    line.WriteString("{")
+    writeJSONField(&line, "ts", time.Now().UTC().Format(time.RFC3339Nano))
+    writeJSONField(&line, "level", level)
+    if l.verbosity > 0 {
+        writeJSONField(&line, "v", l.verbosity)
+    }
+    if l.name != "" {
+        writeJSONField(&line, "logger", l.name)
+    }
+    writeJSONField(&line, "msg", string(bytes.TrimRight([]byte(msg), "\n")))
+    if err != nil {
+        writeJSONField(&line, "err", redactString(err.Error()))
+    }
+    fields := append(append([]interface{}{}, l.values...), keysAndValues...)
+    for i := 0; i < len(fields); i += 2 {
+        key, ok := fields[i].(string)
+        if !ok {
+            key = fmt.Sprint(fields[i])
+        }
+        var value interface{} = "(missing)"
+        if i+1 < len(fields) {
+            value = fields[i+1]
+        }
+        if e, ok := value.(error); ok {
+            value = e.Error()
+        }
+        writeJSONField(&line, key, value)
+    }
+    line.WriteString("}\n")
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    l.out.Write(line.Bytes())
+}
+
+// writeJSONField appends a "key":value pair to a JSON object. Values that cannot be marshalled are logged as strings.
+func writeJSONField(line *bytes.Buffer, key string, value interface{}) {
+    if line.Len() > 1 {
+        line.WriteString(",")
+    }
+    encodedKey, _ := json.Marshal(key)
+    line.Write(encodedKey)
+    line.WriteString(":")
+    encodedValue, err := json.Marshal(value)
+    if err != nil {
+        encodedValue, _ = json.Marshal(fmt.Sprint(value))
+    }
+    line.Write(encodedValue)
+}
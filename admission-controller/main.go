@@ -17,13 +17,21 @@ limitations under the License.
 package main
 
 import (
+    "context"
     "encoding/json"
     "flag"
     "fmt"
     "io/ioutil"
+    "mime"
     "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
 
     admission "k8s.io/api/admission/v1"
+    admissionv1beta1 "k8s.io/api/admission/v1beta1"
+    "k8s.io/apimachinery/pkg/runtime"
     "k8s.io/klog/v2"
 )
 
@@ -31,60 +39,120 @@ var (
     config Config
 )
 
-// handle the http and decoding portion of a request
+// admitFunc is the type of the functions that handle an AdmissionReview.
+type admitFunc func(admission.AdmissionReview) *admission.AdmissionResponse
+
+// serveMutatePods handles requests to mutate pods.
 func serveMutatePods(w http.ResponseWriter, r *http.Request) {
-    var body []byte
-    if r.Body != nil {
-        if data, err := ioutil.ReadAll(r.Body); err == nil {
-            body = data
-        }
+    serve(w, r, mutatePods)
+}
+
+// serveValidate handles requests to validate workloads.
+func serveValidate(w http.ResponseWriter, r *http.Request) {
+    serve(w, r, validateWorkloads)
+}
+
+// maxRequestBodyBytes limits the size of the AdmissionReview requests that are accepted. The objects
+// in a request can be up to around 1.5MB, and there can be two of them (object and oldObject).
+const maxRequestBodyBytes = 3 * 1024 * 1024
+
+// httpError rejects a request that is not a valid AdmissionReview, without calling the webhook.
+func httpError(w http.ResponseWriter, webhook string, status int, msg string) {
+    klog.ErrorS(nil, "Rejected request", "webhook", webhook, "status", status, "reason", msg)
+    admissionRequests.WithLabelValues(webhook, "error", strconv.Itoa(status)).Inc()
+    http.Error(w, msg, status)
+}
+
+// handle the http and decoding portion of a request
+func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
+    webhook := strings.TrimPrefix(r.URL.Path, "/")
+    start := time.Now()
+    defer func() { admissionDuration.WithLabelValues(webhook).Observe(time.Since(start).Seconds()) }()
+
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        httpError(w, webhook, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s is not allowed, expect POST", r.Method))
+        return
     }
 
     // verify the content type is correct
     contentType := r.Header.Get("Content-Type")
-    if contentType != "application/json" {
-        klog.Errorf("contentType=%s, expect application/json", contentType)
+    if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+        httpError(w, webhook, http.StatusUnsupportedMediaType, fmt.Sprintf("contentType=%s, expect application/json", contentType))
+        return
+    }
+
+    // read the request, making sure it is not too large
+    if r.Body == nil {
+        httpError(w, webhook, http.StatusBadRequest, "Request has no body")
+        return
+    }
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+    if err != nil {
+        status := http.StatusBadRequest
+        if len(body) >= maxRequestBodyBytes {
+            status = http.StatusRequestEntityTooLarge
+        }
+        httpError(w, webhook, status, fmt.Sprintf("Request body could not be read: %v", err))
         return
     }
 
-    klog.V(2).Infof("Handling request: %s", body)
+    klog.V(2).InfoS("Handling request", "webhook", webhook, "request", loggedJSON(body))
 
     // decode the request
     deserializer := codecs.UniversalDeserializer()
     obj, gvk, err := deserializer.Decode(body, nil, nil)
     if err != nil {
-        msg := fmt.Sprintf("Request could not be decoded: %v", err)
-        klog.Error(msg)
-        http.Error(w, msg, http.StatusBadRequest)
+        httpError(w, webhook, http.StatusBadRequest, fmt.Sprintf("Request could not be decoded: %v", err))
         return
     }
 
-    // generate an AdmissionReview response based on the request
-    var response admission.AdmissionReview
+    // generate an AdmissionReview response based on the request, in the same version as the request
+    var response runtime.Object
     switch *gvk {
+    case admissionv1beta1.SchemeGroupVersion.WithKind("AdmissionReview"):
+        request, ok := obj.(*admissionv1beta1.AdmissionReview)
+        if !ok {
+            httpError(w, webhook, http.StatusBadRequest, fmt.Sprintf("Expected v1beta1.AdmissionReview but got: %T", obj))
+            return
+        }
+        if request.Request == nil {
+            httpError(w, webhook, http.StatusBadRequest, "AdmissionReview has no request")
+            return
+        }
+        responseAdmissionReview := &admissionv1beta1.AdmissionReview{}
+        responseAdmissionReview.SetGroupVersionKind(*gvk)
+        review := admission.AdmissionReview{Request: convertAdmissionRequestToV1(request.Request)}
+        responseAdmissionReview.Response = convertAdmissionResponseToV1beta1(admit(review))
+        responseAdmissionReview.Response.UID = request.Request.UID
+        response = responseAdmissionReview
     case admission.SchemeGroupVersion.WithKind("AdmissionReview"):
         request, ok := obj.(*admission.AdmissionReview)
         if !ok {
-            klog.Errorf("Expected admission.AdmissionReview but got: %T", obj)
+            httpError(w, webhook, http.StatusBadRequest, fmt.Sprintf("Expected v1.AdmissionReview but got: %T", obj))
+            return
+        }
+        if request.Request == nil {
+            httpError(w, webhook, http.StatusBadRequest, "AdmissionReview has no request")
             return
         }
-        response.SetGroupVersionKind(*gvk)
-        response.Response = mutatePods(*request)
-        response.Response.UID = request.Request.UID
+        responseAdmissionReview := &admission.AdmissionReview{}
+        responseAdmissionReview.SetGroupVersionKind(*gvk)
+        responseAdmissionReview.Response = admit(*request)
+        responseAdmissionReview.Response.UID = request.Request.UID
+        response = responseAdmissionReview
     default:
-        msg := fmt.Sprintf("Unsupported group version kind: %v", gvk)
-        klog.Error(msg)
-        http.Error(w, msg, http.StatusBadRequest)
+        httpError(w, webhook, http.StatusBadRequest, fmt.Sprintf("Unsupported group version kind: %v", gvk))
         return
     }
 
-    klog.V(2).Infof("Sending response: %v", response)
     responseBytes, err := json.Marshal(response)
     if err != nil {
         klog.Error(err)
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
+    klog.V(2).InfoS("Sending response", "webhook", webhook, "response", loggedJSON(responseBytes))
     w.Header().Set("Content-Type", "application/json")
     if _, err := w.Write(responseBytes); err != nil {
         klog.Error(err)
@@ -92,11 +160,118 @@ func serveMutatePods(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "render":
+            os.Exit(runRender(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+        case "lint":
+            os.Exit(runLint(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+        }
+    }
+
     klog.InitFlags(&flag.FlagSet{})
     config.addFlags()
     flag.Parse()
+    if err := setupLogging(config.LogFormat, splitList(config.RedactAnnotations)); err != nil {
+        klog.Fatal(err)
+    }
+
+    client, err := newClientset(config.Kubeconfig)
+    if err != nil {
+        klog.Warning("Unable to create Kubernetes client, pods that need a service account or namespace lookup will be denied: ", err)
+    } else {
+        clientset = client
+    }
+    if config.Events && clientset != nil {
+        eventEmitter = newEventEmitter(clientset, float32(config.EventQPS), config.EventBurst)
+    }
+
+    if config.AuditLog != "" {
+        sink, err := newAuditSink(config.AuditLog)
+        if err != nil {
+            klog.Fatal(err)
+        }
+        auditSink = sink
+    }
+
+    if config.PolicyFile != "" {
+        policyFile = newPolicyFile(config.PolicyFile)
+        if _, err := policyFile.load(); err != nil {
+            klog.Error(err)
+        }
+    }
+    if config.RulesFile != "" {
+        rulesFile = newRulesFile(config.RulesFile)
+        if _, err := rulesFile.load(); err != nil {
+            klog.Error(err)
+        }
+    }
+
+    tlsConfig, err := newTLSConfig(config.TLSMinVersion, config.TLSCipherSuites, nil)
+    if err != nil {
+        klog.Fatal(err)
+    }
+    if config.ClientCAFile != "" {
+        var allowedNames []string
+        if config.ClientAllowedNames != "" {
+            allowedNames = splitList(config.ClientAllowedNames)
+        }
+        if err := requireClientCertificates(tlsConfig, config.ClientCAFile, allowedNames); err != nil {
+            klog.Fatal(err)
+        }
+        if config.HealthAddress == "" {
+            klog.Warning("--client-ca-file is set and --health-address is empty, so health checks and metrics also require a client certificate")
+        }
+    } else if config.ClientAllowedNames != "" {
+        klog.Fatal("--client-allowed-names requires --client-ca-file")
+    }
 
-    http.HandleFunc("/mutating-pods", serveMutatePods)
-    http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
-    klog.Fatal(http.ListenAndServeTLS(":8443", config.CertFile, config.KeyFile, nil))
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    if config.ManageCertificates {
+        if clientset == nil {
+            klog.Fatal("A Kubernetes client is required to manage certificates")
+        }
+        if config.Namespace == "" {
+            if config.Namespace, err = currentNamespace(); err != nil {
+                klog.Fatal(err)
+            }
+        }
+        certWatcher, _ = newCertWatcher("", "", config.CertExpiryWarning)
+        certManager := newCertManager(clientset, config.Namespace, config.CertificateSecret, config.ServiceName, config.WebhookName, certWatcher)
+        go certManager.run(ctx)
+    } else {
+        if config.CertFile == "" || config.KeyFile == "" {
+            klog.Fatal("--tls-cert-file and --tls-private-key-file are required unless --manage-certificates is set")
+        }
+        certWatcher, err = newCertWatcher(config.CertFile, config.KeyFile, config.CertExpiryWarning)
+        if err != nil {
+            klog.Fatal(err)
+        }
+    }
+    go certWatcher.watch(time.Minute)
+
+    tlsConfig.GetCertificate = certWatcher.GetCertificate
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/mutating-pods", serveMutatePods)
+    mux.HandleFunc("/validate", serveValidate)
+    if config.Explain {
+        if clientset == nil {
+            klog.Fatal("A Kubernetes client is required to authenticate requests to /explain")
+        }
+        mux.HandleFunc("/explain", serveExplain)
+    }
+    webhookServer := newServer(config.ListenAddress, mux)
+    webhookServer.TLSConfig = tlsConfig
+    var healthServer *http.Server
+    if config.HealthAddress != "" {
+        healthMux := http.NewServeMux()
+        addHealthHandlers(healthMux)
+        healthServer = newServer(config.HealthAddress, healthMux)
+    } else {
+        addHealthHandlers(mux)
+    }
+    runServers(webhookServer, healthServer, cancel)
+    eventEmitter.shutdown()
 }
@@ -0,0 +1,266 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    admission "k8s.io/api/admission/v1"
+    admissionv1beta1 "k8s.io/api/admission/v1beta1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+// errorReader fails every read, to simulate a connection that breaks while the body is being read.
+type errorReader struct{}
+
+func (errorReader) Read(p []byte) (int, error) {
+    return 0, errors.New("connection reset")
+}
+
+func readExampleRequest(t *testing.T, name string) []byte {
+    t.Helper()
+    body, err := ioutil.ReadFile(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return body
+}
+
+// withCluster uses a fake clientset while a test runs, containing the example requests' namespace and its
+// default service account as well as the given objects.
+func withCluster(t *testing.T, objects ...runtime.Object) *fake.Clientset {
+    t.Helper()
+    objects = append([]runtime.Object{
+        &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "my-namespace"}},
+        &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "default", Namespace: "my-namespace"}},
+    }, objects...)
+    client := fake.NewSimpleClientset(objects...)
+    clientset = client
+    t.Cleanup(func() { clientset = nil })
+    return client
+}
+
+func postMutatePods(body []byte) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodPost, "/mutating-pods", bytes.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    recorder := httptest.NewRecorder()
+    serveMutatePods(recorder, request)
+    return recorder
+}
+
+func decodeAdmissionResponse(t *testing.T, recorder *httptest.ResponseRecorder) *admission.AdmissionResponse {
+    t.Helper()
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("expected HTTP status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+    review := admission.AdmissionReview{}
+    if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil {
+        t.Fatalf("response is not an AdmissionReview: %v", err)
+    }
+    if review.APIVersion != "admission.k8s.io/v1" || review.Kind != "AdmissionReview" {
+        t.Errorf("expected a v1 AdmissionReview, got %s %s", review.APIVersion, review.Kind)
+    }
+    if review.Response == nil {
+        t.Fatal("AdmissionReview has no response")
+    }
+    return review.Response
+}
+
+func TestServeMutatePodsAllowed(t *testing.T) {
+    withCluster(t)
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request.json")))
+    if !response.Allowed {
+        t.Fatalf("expected request to be allowed, got %v", response.Result)
+    }
+    if response.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" {
+        t.Errorf("expected response UID to match request, got %q", response.UID)
+    }
+    if len(response.Patch) == 0 || response.PatchType == nil || *response.PatchType != admission.PatchTypeJSONPatch {
+        t.Errorf("expected a JSON patch, got %q", response.Patch)
+    }
+}
+
+func TestServeMutatePodsInvalidAnnotations(t *testing.T) {
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request-b.json")))
+    if response.Allowed {
+        t.Fatal("expected request with an invalid secret ARN to be denied")
+    }
+    if response.Result == nil || response.Result.Status != meta.StatusFailure {
+        t.Fatalf("expected a failure status, got %v", response.Result)
+    }
+    if response.Result.Code != http.StatusBadRequest || response.Result.Reason != meta.StatusReasonBadRequest {
+        t.Errorf("expected code %d and reason %s, got %d and %s", http.StatusBadRequest, meta.StatusReasonBadRequest, response.Result.Code, response.Result.Reason)
+    }
+    if !strings.Contains(response.Result.Message, "secrets.aws.k8s/secretArns") {
+        t.Errorf("expected message to name the invalid annotation, got %q", response.Result.Message)
+    }
+}
+
+func TestServeMutatePodsV1beta1(t *testing.T) {
+    recorder := postMutatePods(readExampleRequest(t, "example-request-c.json"))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("expected HTTP status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+    review := admissionv1beta1.AdmissionReview{}
+    if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil {
+        t.Fatalf("response is not an AdmissionReview: %v", err)
+    }
+    if review.APIVersion != "admission.k8s.io/v1beta1" || review.Kind != "AdmissionReview" {
+        t.Errorf("expected a v1beta1 AdmissionReview, got %s %s", review.APIVersion, review.Kind)
+    }
+    if review.Response == nil {
+        t.Fatal("AdmissionReview has no response")
+    }
+    if review.Response.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" {
+        t.Errorf("expected response UID to match request, got %q", review.Response.UID)
+    }
+    if review.Response.Allowed {
+        t.Fatal("expected request with an invalid secret ARN to be denied")
+    }
+    if review.Response.Result == nil || review.Response.Result.Code != http.StatusBadRequest {
+        t.Errorf("expected code %d, got %v", http.StatusBadRequest, review.Response.Result)
+    }
+}
+
+func TestServeMutatePodsV1beta1Allowed(t *testing.T) {
+    withCluster(t)
+    body := bytes.Replace(readExampleRequest(t, "example-request.json"), []byte(`"admission.k8s.io/v1"`), []byte(`"admission.k8s.io/v1beta1"`), 1)
+    recorder := postMutatePods(body)
+    review := admissionv1beta1.AdmissionReview{}
+    if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil {
+        t.Fatalf("response is not an AdmissionReview: %v", err)
+    }
+    if review.APIVersion != "admission.k8s.io/v1beta1" || review.Response == nil {
+        t.Fatalf("expected a v1beta1 AdmissionReview with a response, got %s", recorder.Body.String())
+    }
+    if !review.Response.Allowed {
+        t.Fatalf("expected request to be allowed, got %v", review.Response.Result)
+    }
+    if len(review.Response.Patch) == 0 || review.Response.PatchType == nil || *review.Response.PatchType != admissionv1beta1.PatchTypeJSONPatch {
+        t.Errorf("expected a JSON patch, got %q", review.Response.Patch)
+    }
+}
+
+func TestServeMutatePodsBadRequests(t *testing.T) {
+    example := readExampleRequest(t, "example-request.json")
+    tests := []struct {
+        name string
+        method string
+        contentType string
+        status int
+    }{
+        {name: "wrong method", method: http.MethodGet, contentType: "application/json", status: http.StatusMethodNotAllowed},
+        {name: "wrong content type", method: http.MethodPost, contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+        {name: "missing content type", method: http.MethodPost, status: http.StatusUnsupportedMediaType},
+        {name: "content type with parameters", method: http.MethodPost, contentType: "application/json; charset=utf-8", status: http.StatusOK},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            request := httptest.NewRequest(test.method, "/mutating-pods", bytes.NewReader(example))
+            if test.contentType != "" {
+                request.Header.Set("Content-Type", test.contentType)
+            }
+            recorder := httptest.NewRecorder()
+            serveMutatePods(recorder, request)
+            if recorder.Code != test.status {
+                t.Errorf("expected HTTP status %d, got %d: %s", test.status, recorder.Code, recorder.Body.String())
+            }
+        })
+    }
+}
+
+func TestServeMutatePodsBadBodies(t *testing.T) {
+    example := readExampleRequest(t, "example-request.json")
+    tests := []struct {
+        name string
+        body []byte
+        status int
+    }{
+        {name: "too large", body: append(example, bytes.Repeat([]byte(" "), maxRequestBodyBytes)...), status: http.StatusRequestEntityTooLarge},
+        {name: "invalid json", body: []byte(`{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview", "request": `), status: http.StatusBadRequest},
+        {name: "not an admission review", body: []byte(`{"apiVersion": "v1", "kind": "Pod"}`), status: http.StatusBadRequest},
+        {name: "missing request", body: []byte(`{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`), status: http.StatusBadRequest},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            recorder := postMutatePods(test.body)
+            if recorder.Code != test.status {
+                t.Errorf("expected HTTP status %d, got %d: %s", test.status, recorder.Code, recorder.Body.String())
+            }
+        })
+    }
+}
+
+func TestServeMutatePodsReadError(t *testing.T) {
+    request := httptest.NewRequest(http.MethodPost, "/mutating-pods", errorReader{})
+    request.Header.Set("Content-Type", "application/json")
+    recorder := httptest.NewRecorder()
+    serveMutatePods(recorder, request)
+    if recorder.Code != http.StatusBadRequest {
+        t.Errorf("expected HTTP status %d, got %d", http.StatusBadRequest, recorder.Code)
+    }
+}
+
+func TestServeMutatePodsWithoutCluster(t *testing.T) {
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request.json")))
+    if response.Allowed || response.Result == nil || response.Result.Code != http.StatusInternalServerError {
+        t.Fatalf("expected the pod to be denied without a Kubernetes client, got %v", response.Result)
+    }
+    if !strings.Contains(response.Result.Message, "unable to look up service account my-namespace/default") {
+        t.Errorf("expected the message to explain the service account could not be looked up, got %q", response.Result.Message)
+    }
+}
+
+func TestToV1AdmissionResponseCodes(t *testing.T) {
+    tests := []struct {
+        err error
+        code int32
+        reason meta.StatusReason
+        cause string
+    }{
+        {err: errors.New("denied"), code: http.StatusForbidden, reason: meta.StatusReasonForbidden, cause: deniedOther},
+        {err: badRequest(deniedInvalidAnnotations, errors.New("bad")), code: http.StatusBadRequest, reason: meta.StatusReasonBadRequest, cause: deniedInvalidAnnotations},
+        {err: internalError(deniedLookupFailed, errors.New("broken")), code: http.StatusInternalServerError, reason: meta.StatusReasonInternalError, cause: deniedLookupFailed},
+        {err: fmt.Errorf("Deployment app: %w", forbidden(deniedPolicy, errors.New("denied"))), code: http.StatusForbidden, reason: meta.StatusReasonForbidden, cause: deniedPolicy},
+    }
+    for _, test := range tests {
+        response := toV1AdmissionResponse(test.err, admission.AdmissionReview{Request: &admission.AdmissionRequest{}})
+        if response.Allowed {
+            t.Errorf("%v: expected response to deny the request", test.err)
+        }
+        if response.Result.Code != test.code || response.Result.Reason != test.reason {
+            t.Errorf("%v: expected code %d and reason %s, got %d and %s", test.err, test.code, test.reason, response.Result.Code, response.Result.Reason)
+        }
+        if response.Result.Message != test.err.Error() {
+            t.Errorf("%v: expected message %q, got %q", test.err, test.err.Error(), response.Result.Message)
+        }
+        if cause := denialCause(test.err); cause != test.cause {
+            t.Errorf("%v: expected cause %s, got %s", test.err, test.cause, cause)
+        }
+    }
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "sigs.k8s.io/yaml"
+)
+
+// manifestDocument is one of the YAML or JSON documents in a manifest file, converted to JSON.
+type manifestDocument struct {
+    path string
+    line int /* line of the file the document starts on */
+    text string
+    data []byte
+}
+
+// manifestError is a document that is not valid YAML or JSON.
+type manifestError struct {
+    path string
+    line int
+    err error
+}
+
+func (e *manifestError) Error() string {
+    return fmt.Sprintf("Invalid manifest in %s at line %d: %v", e.path, e.line, e.err)
+}
+
+// readManifestFile reads the documents in a manifest file, or stdin if the path is -. Documents are separated
+// by --- lines, as kubectl and kustomize output them.
+func readManifestFile(path string, stdin io.Reader) ([]manifestDocument, error) {
+    in := stdin
+    if path != "-" {
+        file, err := os.Open(path)
+        if err != nil {
+            return nil, fmt.Errorf("Unable to read manifest: %v", err)
+        }
+        defer file.Close()
+        in = file
+    }
+    var documents []manifestDocument
+    var text strings.Builder
+    start, line := 1, 0
+    addDocument := func() error {
+        document := manifestDocument{path: path, line: start, text: text.String()}
+        text.Reset()
+        data, err := yaml.YAMLToJSON([]byte(document.text))
+        if err != nil {
+            return &manifestError{path: path, line: document.line, err: err}
+        }
+        if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || string(trimmed) == "null" {
+            return nil /* empty document, e.g. after a trailing --- */
+        }
+        document.data = data
+        documents = append(documents, document)
+        return nil
+    }
+    reader := bufio.NewReader(in)
+    for {
+        content, err := reader.ReadString('\n')
+        if err != nil && err != io.EOF {
+            return nil, fmt.Errorf("Unable to read manifest %s: %v", path, err)
+        }
+        if content != "" {
+            line++
+            if strings.TrimRight(content, " \t\r\n") == "---" {
+                if err := addDocument(); err != nil {
+                    return nil, err
+                }
+                start = line + 1
+            } else {
+                text.WriteString(content)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+    }
+    if err := addDocument(); err != nil {
+        return nil, err
+    }
+    return documents, nil
+}
+
+// lineOf finds the line of a document that first contains the text, or the line the document starts on.
+func (d manifestDocument) lineOf(text string) int {
+    if i := strings.Index(d.text, text); i >= 0 {
+        return d.line + strings.Count(d.text[:i], "\n")
+    }
+    return d.line
+}
+
+// listItems splits a List document into its items, as they are written under a top-level items key in YAML, so
+// that findings can point at the item they are about. It returns nil if the items cannot be found, e.g. if the
+// document is JSON.
+func (d manifestDocument) listItems() []manifestDocument {
+    var items []manifestDocument
+    inItems, indent := false, -1
+    for i, line := range strings.SplitAfter(d.text, "\n") {
+        content := strings.TrimSpace(line)
+        if content == "" || strings.HasPrefix(content, "#") {
+            if len(items) > 0 {
+                items[len(items)-1].text += line
+            }
+            continue
+        }
+        lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+        if !inItems {
+            inItems = lineIndent == 0 && content == "items:"
+            continue
+        }
+        isItem := content == "-" || strings.HasPrefix(content, "- ")
+        if indent < 0 && isItem {
+            indent = lineIndent
+        }
+        if indent < 0 || lineIndent < indent || (lineIndent == indent && !isItem) {
+            break /* the end of the items */
+        }
+        if lineIndent == indent {
+            items = append(items, manifestDocument{path: d.path, line: d.line + i})
+        }
+        items[len(items)-1].text += line
+    }
+    return items
+}
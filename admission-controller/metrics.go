@@ -0,0 +1,99 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    admission "k8s.io/api/admission/v1"
+)
+
+const metricsNamespace = "aws_secret_injector"
+
+var (
+    certificateExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+        Namespace: metricsNamespace,
+        Name: "certificate_expiry_timestamp_seconds",
+        Help: "Time at which the webhook's TLS certificate expires, in seconds since the Unix epoch.",
+    })
+    admissionRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Name: "admission_requests_total",
+        Help: "Admission requests handled, by webhook and outcome (mutated, skipped, allowed, denied or error). The reason is why the request was skipped or denied.",
+    }, []string{"webhook", "outcome", "reason"})
+    admissionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: metricsNamespace,
+        Name: "admission_duration_seconds",
+        Help: "Time taken to handle admission requests, by webhook.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"webhook"})
+    injectedSecrets = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Name: "injected_secrets_total",
+        Help: "Secrets injected into pods, by namespace.",
+    }, []string{"namespace"})
+    patchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+        Namespace: metricsNamespace,
+        Name: "patch_size_bytes",
+        Help: "Size of the JSON patches returned for mutated pods.",
+        Buckets: prometheus.ExponentialBuckets(256, 2, 10),
+    })
+)
+
+const (
+    skippedUnexpectedResource = "unexpected_resource"
+    skippedNotAnnotated = "not_annotated"
+    skippedUnsupportedInjector = "unsupported_injector"
+    skippedAlreadyInjected = "already_injected"
+)
+
+/* why a request was denied; keep this list short, as each value is a separate time series */
+const (
+    deniedInvalidObject = "invalid_object"
+    deniedInvalidAnnotations = "invalid_annotations"
+    deniedInitContainerConflict = "init_container_conflict"
+    deniedPolicy = "policy"
+    deniedRule = "rule"
+    deniedCredentials = "credentials"
+    deniedLookupFailed = "lookup_failed"
+    deniedInternalError = "internal_error"
+    deniedOther = "other"
+)
+
+// recordAdmission counts an admission response by its outcome. reason is why the webhook had nothing to do, or
+// why the request was denied.
+func recordAdmission(webhook string, response *admission.AdmissionResponse, reason string) {
+    outcome, reason := admissionOutcome(response, reason)
+    admissionRequests.WithLabelValues(webhook, outcome, reason).Inc()
+}
+
+// admissionOutcome classifies an admission response as mutated, skipped, allowed or denied, with the reason why
+// it was skipped or denied.
+func admissionOutcome(response *admission.AdmissionResponse, reason string) (string, string) {
+    switch {
+    case !response.Allowed:
+        if reason == "" {
+            reason = deniedOther
+        }
+        return "denied", reason
+    case len(response.Patch) > 0:
+        return "mutated", ""
+    case reason != "":
+        return "skipped", reason
+    }
+    return "allowed", ""
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "k8s.io/apimachinery/pkg/api/errors"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const noRegionWarning = "No AWS region is configured for pod annotation secrets.aws.k8s/secretNames - the init container will detect the region from its environment"
+
+// getNamespaceAnnotation looks up an annotation on the given namespace, which is used to set defaults for
+// all pods in that namespace. An empty string is returned if the namespace is not annotated, and an error if
+// the namespace cannot be looked up.
+func getNamespaceAnnotation(namespace string, annotation string) (string, error) {
+    if offline {
+        return "", nil
+    }
+    if clientset == nil {
+        return "", internalError(deniedLookupFailed, fmt.Errorf("No Kubernetes client available - unable to look up namespace %s", namespace))
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, meta.GetOptions{})
+    if errors.IsNotFound(err) {
+        return "", badRequest(deniedLookupFailed, fmt.Errorf("Namespace %s not found - unable to look up its default region", namespace))
+    }
+    if err != nil {
+        return "", internalError(deniedLookupFailed, fmt.Errorf("Unable to look up namespace %s: %v", namespace, err))
+    }
+    return ns.ObjectMeta.Annotations[annotation], nil
+}
+
+// getDefaultRegion returns the region to use when a pod does not set secrets.aws.k8s/region. The namespace
+// annotation takes precedence over the cluster default set with --default-region.
+func getDefaultRegion(namespace string, log requestLogger) (string, error) {
+    region, err := getNamespaceAnnotation(namespace, "secrets.aws.k8s/region")
+    if err != nil {
+        return "", err
+    }
+    if region != "" {
+        log.info("Using region from namespace annotation secrets.aws.k8s/region", "region", region, "namespace", namespace)
+        return region, nil
+    }
+    if config.DefaultRegion != "" {
+        log.info("Using default region", "region", config.DefaultRegion)
+    }
+    return config.DefaultRegion, nil
+}
+
+// resolveRegion works out the region for secrets listed by name, falling back to the defaults if the pod
+// does not have a secrets.aws.k8s/region annotation. An empty region means the init container will detect it.
+func resolveRegion(secretAnnotations *SecretAnnotations, namespace string, log requestLogger) (string, []string, error) {
+    if secretAnnotations.SecretNames == nil {
+        return "", nil, nil
+    }
+    if secretAnnotations.Region != "" {
+        log.info("Using region from pod annotation secrets.aws.k8s/region", "region", secretAnnotations.Region)
+        return secretAnnotations.Region, nil, nil
+    }
+    region, err := getDefaultRegion(namespace, log)
+    if err != nil || region != "" {
+        return region, nil, err
+    }
+    return "", []string{noRegionWarning}, nil
+}
@@ -21,14 +21,26 @@ import (
     admission "k8s.io/api/admission/v1"
     core "k8s.io/api/core/v1"
     meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
     "k8s.io/apimachinery/pkg/api/resource"
-    "k8s.io/klog/v2"
     "encoding/json"
 )
 
 var (
     False = false
     True = true
+    errRoleArnNotFound = fmt.Errorf("Unable to determine value for AWS_ROLE_ARN")
+)
+
+const secretVolumeWarning = "Pod already has a volume named secret-vol. Secrets will be written to that volume."
+
+/* which check a warning returned by mutatePod comes from, so that it can be reported without parsing its message */
+const (
+    warnedAnnotations = "annotations"
+    warnedRegion = "region"
+    warnedRule = "rule"
+    warnedCredentials = "credentials"
+    warnedSecretVolume = "secret_volume"
 )
 
 type Patch struct {
@@ -37,6 +49,20 @@ type Patch struct {
     Value interface{} `json:"value"`
 }
 
+// podName identifies the pod in log messages. Pods created by controllers only have a generateName when they
+// are admitted.
+func podName(pod core.Pod, request *admission.AdmissionRequest) string {
+    switch {
+    case pod.ObjectMeta.Name != "":
+        return pod.ObjectMeta.Name
+    case request.Name != "":
+        return request.Name
+    case pod.ObjectMeta.GenerateName != "":
+        return pod.ObjectMeta.GenerateName + "*"
+    }
+    return ""
+}
+
 func hasContainer(containers []core.Container, containerName string) bool {
     for _, container := range containers {
         if container.Name == containerName {
@@ -55,58 +81,114 @@ func hasVolume(volumes []core.Volume, volumeName string) bool {
     return false
 }
 
-func getRoleArn(containers []core.Container) (string, error) {
+// getRoleArn finds the AWS_ROLE_ARN env var set on the containers (e.g. by the EKS pod identity webhook).
+// Env vars using valueFrom are returned as-is, so the init container resolves them the same way. An error is
+// returned if the containers disagree on the value.
+func getRoleArn(containers []core.Container) (core.EnvVar, error) {
+    var roleArn *core.EnvVar
+    roleArnContainer := ""
     for _, container := range containers {
-        for _, envVar := range container.Env {
-            if envVar.Name == "AWS_ROLE_ARN" {
-                return envVar.Value, nil
+        for i, envVar := range container.Env {
+            if envVar.Name != "AWS_ROLE_ARN" || (envVar.Value == "" && envVar.ValueFrom == nil) {
+                continue
+            }
+            if roleArn == nil {
+                roleArn = &container.Env[i]
+                roleArnContainer = container.Name
+            } else if !equality.Semantic.DeepEqual(*roleArn, envVar) {
+                return core.EnvVar{}, badRequest(deniedCredentials, fmt.Errorf("Containers %s and %s have different values for AWS_ROLE_ARN - unable to determine which role the init container should use", roleArnContainer, container.Name))
             }
         }
     }
-    return "", fmt.Errorf("Unable to determine value for AWS_ROLE_ARN")
+    if roleArn == nil {
+        return core.EnvVar{}, errRoleArnNotFound
+    }
+    return *roleArn, nil
 }
 
 func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
-    klog.Info("Mutating pods")
+    return mutatePod(ar, newRequestLogger(ar.Request), newAuditEvent("mutating-pods", ar.Request), true)
+}
+
+// mutatePod decides how to patch a pod, filling in the audit event as it goes. The outcome is only recorded in
+// the metrics, audit log and events if record is set, so that requests can be explained without side effects.
+func mutatePod(ar admission.AdmissionReview, log requestLogger, audit *AuditEvent, record bool) (response *admission.AdmissionResponse) {
+    log.info("Mutating pod")
+    reason := ""
+    pod := core.Pod{}
+    defer func() {
+        audit.complete(response, reason)
+        if record {
+            recordAdmission("mutating-pods", response, reason)
+            auditSink.record(audit)
+            eventEmitter.emit(&pod, audit)
+        }
+    }()
     /* prepare the response */
     reviewResponse := admission.AdmissionResponse{
         Allowed: true,
         UID: ar.Request.UID,
     }
+    deny := func(err error) *admission.AdmissionResponse {
+        reason = denialCause(err)
+        return toV1AdmissionResponse(err, ar)
+    }
+    warn := func(reason string, warnings ...string) {
+        for _, warning := range warnings {
+            log.warning(warning)
+            audit.addWarningReason(warning, reason)
+        }
+        reviewResponse.Warnings = append(reviewResponse.Warnings, warnings...)
+    }
 
     /* examine the request */
     podResourceType := meta.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
     if ar.Request.Resource != podResourceType {
-        klog.Error("Unexpected resource type ", ar.Request.Resource)
+        log.error(nil, "Unexpected resource type", "resource", ar.Request.Resource)
+        reason = skippedUnexpectedResource
         return &reviewResponse  //something is wonky on the Kubernetes side - just send back an "Allow"
     }
 
     /* deserialize the raw request into a pod object */
     raw := ar.Request.Object.Raw
-    pod := core.Pod{}
     deserializer := codecs.UniversalDeserializer()
     if _, _, err := deserializer.Decode(raw, nil, &pod); err != nil {
-        klog.Error("Unable to decode pod object: ", err)
-        return toV1AdmissionResponse(err, ar)
+        log.error(err, "Unable to decode pod object")
+        return deny(badRequest(deniedInvalidObject, err))
     }
 
     /* examine the injectorWebhook annotation */
-    klog.Info("Pod annotations:", pod.ObjectMeta.Annotations)
-    annotation_injector_webhook, ok := pod.ObjectMeta.Annotations["secrets.aws.k8s/injectorWebhook"]
-    if !ok {
-        klog.Info("Pod annotation secrets.aws.k8s/injectorWebhook not set - no action required")
+    log = log.withValues("pod", podName(pod, ar.Request))
+    audit.Name = podName(pod, ar.Request)
+    audit.ServiceAccount = pod.Spec.ServiceAccountName
+    log.info("Pod annotations", "annotations", pod.ObjectMeta.Annotations)
+    secretAnnotations, err := parseSecretAnnotations(pod.ObjectMeta.Annotations)
+    if err != nil {
+        log.error(err, "Invalid secret injection annotations")
+        return deny(badRequest(deniedInvalidAnnotations, err))
+    }
+    audit.setSecrets(secretAnnotations)
+    warn(warnedAnnotations, secretAnnotations.Warnings...)
+    if secretAnnotations.InjectorWebhook == "" {
+        log.info("Pod annotation secrets.aws.k8s/injectorWebhook not set - no action required")
+        reason = skippedNotAnnotated
         return &reviewResponse
     }
-    klog.Info("Pod annotation secrets.aws.k8s/injectorWebhook is set to ", annotation_injector_webhook)
+    log.info("Pod annotation secrets.aws.k8s/injectorWebhook is set", "injectorWebhook", secretAnnotations.InjectorWebhook)
 
     /* decide how to patch the pod */
     /* TODO add sidecar option */
-    if annotation_injector_webhook == "init-container" {
-        klog.Info("Injecting init container")
+    if secretAnnotations.InjectorWebhook == "init-container" {
+        if alreadyInjected(pod) {
+            log.info("Secrets have already been injected into the pod", "injectorVersion", pod.ObjectMeta.Annotations[injectorVersionAnnotation])
+            reason = skippedAlreadyInjected
+            return &reviewResponse
+        }
+        log.info("Injecting init container")
         if hasContainer(pod.Spec.InitContainers, "secrets-init-container") {
             err := "Pod already has an init container named secrets-init-container"
-            klog.Error(err)
-            return toV1AdmissionResponse(fmt.Errorf("%s", err), ar)
+            log.error(nil, err)
+            return deny(badRequest(deniedInitContainerConflict, fmt.Errorf("%s", err)))
         }
         
         var patches []Patch
@@ -142,24 +224,14 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
                 Value: "regional",
             },
         }
-        _, secretArnsSet := pod.ObjectMeta.Annotations["secrets.aws.k8s/secretArns"]
-        _, secretNamesSet := pod.ObjectMeta.Annotations["secrets.aws.k8s/secretNames"]
-        _, explodeJsonKeysSet := pod.ObjectMeta.Annotations["secrets.aws.k8s/explodeJsonKeys"]
-        annotation_region, regionSet := pod.ObjectMeta.Annotations["secrets.aws.k8s/region"]
-        if secretArnsSet && secretNamesSet {
-            err := "Only one of pod annotations secrets.aws.k8s/secretArns and secrets.aws.k8s/secretNames can be set"
-            klog.Error(err)
-            return toV1AdmissionResponse(fmt.Errorf("%s", err), ar)
-        }
-        if !secretArnsSet && !secretNamesSet {
-            err := "One of pod annotations secrets.aws.k8s/secretArns or secrets.aws.k8s/secretNames must be set"
-            klog.Error(err)
-            return toV1AdmissionResponse(fmt.Errorf("%s", err), ar)
+        region, regionWarnings, err := resolveRegion(secretAnnotations, ar.Request.Namespace, log)
+        if err != nil {
+            log.error(err, "Unable to resolve region")
+            return deny(err)
         }
-        if secretArnsSet {
-            if regionSet {
-                klog.Warning("Pod annotation secrets.aws.k8s/secretArns is set, so secrets.aws.k8s/region will be ignored")
-            }
+        warn(warnedRegion, regionWarnings...)
+        audit.Region = region
+        if secretAnnotations.SecretArns != nil {
             env = append(env, core.EnvVar{
                 Name: "SECRET_ARNS",
                 ValueFrom: &core.EnvVarSource{
@@ -168,27 +240,23 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
                     },
                 },
             })
-        } else if secretNamesSet {
-            if !regionSet {
-                err := "Pod annotation secrets.aws.k8s/secretNames requires that annotation secrets.aws.k8s/region is also set"
-                klog.Error(err)
-                return toV1AdmissionResponse(fmt.Errorf("%s", err), ar)
-            } else {
+        } else {
+            if region != "" {
                 env = append(env, core.EnvVar{
                     Name: "SECRET_REGION",
-                    Value: annotation_region,
-                })
-                env = append(env, core.EnvVar{
-                    Name: "SECRET_NAMES", 
-                    ValueFrom: &core.EnvVarSource{
-                        FieldRef: &core.ObjectFieldSelector{
-                            FieldPath: "metadata.annotations['secrets.aws.k8s/secretNames']",
-                        },
-                    },
+                    Value: region,
                 })
             }
+            env = append(env, core.EnvVar{
+                Name: "SECRET_NAMES", 
+                ValueFrom: &core.EnvVarSource{
+                    FieldRef: &core.ObjectFieldSelector{
+                        FieldPath: "metadata.annotations['secrets.aws.k8s/secretNames']",
+                    },
+                },
+            })
         }
-        if explodeJsonKeysSet {
+        if secretAnnotations.ExplodeJsonKeys != nil {
             env = append(env, core.EnvVar{
                 Name: "EXPLODE_JSON_KEYS", 
                 ValueFrom: &core.EnvVarSource{
@@ -198,6 +266,46 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
                 },
             })
         }
+        if secretAnnotations.RoleArn != "" {
+            env = append(env, core.EnvVar{
+                Name: "ROLE_ARN",
+                ValueFrom: &core.EnvVarSource{
+                    FieldRef: &core.ObjectFieldSelector{
+                        FieldPath: "metadata.annotations['secrets.aws.k8s/roleArn']",
+                    },
+                },
+            })
+        }
+        if secretAnnotations.ExternalId != "" {
+            env = append(env, core.EnvVar{
+                Name: "ROLE_EXTERNAL_ID",
+                ValueFrom: &core.EnvVarSource{
+                    FieldRef: &core.ObjectFieldSelector{
+                        FieldPath: "metadata.annotations['secrets.aws.k8s/externalId']",
+                    },
+                },
+            })
+        }
+        if secretAnnotations.SecretRoles != nil {
+            env = append(env, core.EnvVar{
+                Name: "SECRET_ROLES",
+                ValueFrom: &core.EnvVarSource{
+                    FieldRef: &core.ObjectFieldSelector{
+                        FieldPath: "metadata.annotations['secrets.aws.k8s/secretRoles']",
+                    },
+                },
+            })
+        }
+        if pod.ObjectMeta.Namespace == "" {
+            pod.ObjectMeta.Namespace = ar.Request.Namespace /* not set on the pod when it is first created */
+        }
+        var accessWarnings []string
+        audit.PolicyDecision, accessWarnings, err = checkSecretAccess(pod, secretAnnotations, region, ar.Request.UserInfo, log)
+        warn(warnedRule, accessWarnings...)
+        if err != nil {
+            log.error(err, "Secret access denied")
+            return deny(err)
+        }
         volumeMounts := []core.VolumeMount{
             core.VolumeMount{
                 Name: "secret-vol",
@@ -205,26 +313,25 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
                 ReadOnly: false,
             },
         }
-        if hasVolume(pod.Spec.Volumes, "aws-iam-token") {
-            /* pod has already been through the IRSA webhook, so we need to do some work */
-            volumeMounts = append(volumeMounts, core.VolumeMount{
-                Name: "aws-iam-token",
-                MountPath: "/var/run/secrets/eks.amazonaws.com/serviceaccount",
-                ReadOnly: true,
-            })
-            roleArn, err := getRoleArn(pod.Spec.Containers)
-            if err != nil {
-                return toV1AdmissionResponse(fmt.Errorf("%s", err), ar)
-            }
-            env = append(env, core.EnvVar{
-                Name: "AWS_ROLE_ARN",
-                Value: roleArn,
-            })
-            env = append(env, core.EnvVar{
-                Name: "AWS_WEB_IDENTITY_TOKEN_FILE",
-                Value: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
-            })
+        credentialConfig, err := getCredentialConfig(pod, ar.Request.Namespace, log)
+        if err != nil {
+            log.error(err, "Unable to choose a credential mechanism")
+            return deny(err)
         }
+        audit.CredentialMechanism = string(credentialConfig.Mechanism)
+        log.info("Init container will use credential mechanism", "mechanism", credentialConfig.Mechanism, "description", credentialConfig.Mechanism.describe())
+        warn(warnedCredentials, credentialConfig.Warnings...)
+        env = append(env, credentialConfig.Env...)
+        env = append(env, core.EnvVar{
+            Name: "CREDENTIAL_MECHANISM",
+            Value: string(credentialConfig.Mechanism),
+        })
+        env = append(env, core.EnvVar{
+            Name: "LOG_FORMAT",
+            Value: config.LogFormat,
+        })
+        volumeMounts = append(volumeMounts, credentialConfig.VolumeMounts...)
+        volumes := credentialConfig.Volumes
         /* create path /spec/initContainers if its missing */
         if len(pod.Spec.InitContainers) == 0 {
             initContainers := make([]core.Container, 0) /* using make ensures the resulting JSON is [] */
@@ -260,8 +367,15 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
             },
         })
 
-        /* add patches for each container */
-        for i := range pod.Spec.Containers {
+        /* add patches for each container, creating path volumeMounts if its missing (e.g. the service account token is not mounted) */
+        for i, container := range pod.Spec.Containers {
+            if len(container.VolumeMounts) == 0 {
+                patches = append(patches, Patch{
+                    Op: "add",
+                    Path: fmt.Sprintf("/spec/containers/%d/volumeMounts", i),
+                    Value: make([]core.VolumeMount, 0),
+                })
+            }
             patches = append(patches, Patch{
                 Op: "add",
                 Path: fmt.Sprintf("/spec/containers/%d/volumeMounts/-", i),
@@ -275,33 +389,55 @@ func mutatePods(ar admission.AdmissionReview) *admission.AdmissionResponse {
         
         /* add patch to add volume 'secret-vol' if required */
         if hasVolume(pod.Spec.Volumes, "secret-vol") {
-            klog.Info("Pod already has a volume named secret-vol. Secrets will be written to that volume.")
+            warn(warnedSecretVolume, secretVolumeWarning)
         } else {
-            klog.Info("Adding an in-memory volume named secret-vol. Secrets will be written to that volume.")
+            log.info("Adding an in-memory volume named secret-vol. Secrets will be written to that volume.")
+            volumes = append(volumes, core.Volume{
+                Name: "secret-vol",
+                VolumeSource: core.VolumeSource{
+                    EmptyDir: &core.EmptyDirVolumeSource{
+                        Medium: "Memory",
+                    },
+                },
+            })
+        }
+
+        /* add patches for each new volume, creating path /spec/volumes if its missing */
+        if len(pod.Spec.Volumes) == 0 && len(volumes) > 0 {
+            patches = append(patches, Patch{
+                Op: "add",
+                Path: "/spec/volumes",
+                Value: make([]core.Volume, 0),
+            })
+        }
+        for _, volume := range volumes {
             patches = append(patches, Patch{
                 Op: "add",
                 Path: "/spec/volumes/-",
-                Value: core.Volume{
-                    Name: "secret-vol",
-                    VolumeSource: core.VolumeSource{
-                        EmptyDir: &core.EmptyDirVolumeSource{
-                            Medium: "Memory",
-                        },
-                    },
-                },
+                Value: volume,
             })
         }
-        
+
+        /* record what was injected in the status annotations */
+        patches = append(patches, statusPatches(pod, statusAnnotations(secretAnnotations.InjectorWebhook,
+            secretSpecHash(secretAnnotations, region, credentialConfig.Mechanism), config.InitContainerImage))...)
+
         /* reconstruct the JSON string */    
         patchBytes, err := json.Marshal(patches)
         if err != nil {
-            klog.Error("Error marshalling JSON: ", err)
-            return toV1AdmissionResponse(err, ar)
+            log.error(err, "Error marshalling JSON")
+            return deny(internalError(deniedInternalError, err))
         }
         reviewResponse.Patch = patchBytes
         patchType := admission.PatchTypeJSONPatch
         reviewResponse.PatchType = &patchType
-        klog.Info("Patch: ", string(patchBytes))
+        log.info("Patching pod", "patch", loggedJSON(patchBytes))
+        if record {
+            injectedSecrets.WithLabelValues(pod.ObjectMeta.Namespace).Add(float64(len(secretAnnotations.secrets())))
+            patchSize.Observe(float64(len(patchBytes)))
+        }
+    } else {
+        reason = skippedUnsupportedInjector
     }
 
     /* send the response */
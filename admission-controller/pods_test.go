@@ -0,0 +1,400 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    jsonpatch "github.com/evanphx/json-patch"
+    "github.com/pmezard/go-difflib/difflib"
+    admission "k8s.io/api/admission/v1"
+    authentication "k8s.io/api/authentication/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+    "sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata instead of comparing against them")
+
+// mutatePodsCase is an AdmissionReview for a pod, and the cluster and configuration it is admitted with. The
+// result is compared against testdata/mutate-pods/<name>.yaml.
+type mutatePodsCase struct {
+    name string
+    pod string // YAML
+    raw string // the request object, if it is not a pod
+    resource string // the requested resource, if it is not pods
+    objects []runtime.Object // in the cluster, if not just the namespace and its default service account
+    failGet string // a resource the cluster fails to get
+    noClient bool // no Kubernetes client could be created
+    defaultRegion string
+    policy string
+    rules string
+}
+
+// mutatePodsResult is what is compared against a golden file: the admission response, the reason recorded in
+// the metrics and audit log, and the pod after its patch has been applied.
+type mutatePodsResult struct {
+    Allowed bool `json:"allowed"`
+    Reason string `json:"reason,omitempty"`
+    Code int32 `json:"code,omitempty"`
+    Message string `json:"message,omitempty"`
+    Warnings []string `json:"warnings,omitempty"`
+    Pod interface{} `json:"pod,omitempty"`
+}
+
+const (
+    goldenPod = `
+metadata:
+  name: app
+  namespace: team-a
+  annotations:
+    secrets.aws.k8s/injectorWebhook: init-container
+    secrets.aws.k8s/secretArns: arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF
+spec:
+  containers:
+  - name: app
+    image: app:1
+`
+    goldenNamedPod = `
+metadata:
+  name: app
+  namespace: team-a
+  annotations:
+    secrets.aws.k8s/injectorWebhook: init-container
+    secrets.aws.k8s/secretNames: team-a/db,team-a/api
+spec:
+  containers:
+  - name: app
+    image: app:1
+`
+    goldenIRSAPod = `
+metadata:
+  name: app
+  namespace: team-a
+  annotations:
+    secrets.aws.k8s/injectorWebhook: init-container
+    secrets.aws.k8s/secretArns: arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF
+spec:
+  serviceAccountName: app
+  containers:
+  - name: app
+    image: app:1
+    env:
+    - name: AWS_ROLE_ARN
+      value: arn:aws:iam::123456789012:role/app
+    - name: AWS_WEB_IDENTITY_TOKEN_FILE
+      value: /var/run/secrets/eks.amazonaws.com/serviceaccount/token
+    volumeMounts:
+    - name: aws-iam-token
+      mountPath: /var/run/secrets/eks.amazonaws.com/serviceaccount
+      readOnly: true
+  volumes:
+  - name: aws-iam-token
+    projected:
+      sources:
+      - serviceAccountToken:
+          audience: sts.amazonaws.com
+          expirationSeconds: 86400
+          path: token
+`
+)
+
+var (
+    appServiceAccount = &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team-a",
+        Annotations: map[string]string{irsaRoleArnAnnotation: "arn:aws:iam::123456789012:role/app"}}}
+    defaultServiceAccount = &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "default", Namespace: "team-a",
+        Annotations: map[string]string{irsaRoleArnAnnotation: "arn:aws:iam::123456789012:role/default"}}}
+    teamANamespace = &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a"}}
+    unannotatedServiceAccount = &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "default", Namespace: "team-a"}}
+    unannotatedAppServiceAccount = &core.ServiceAccount{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team-a"}}
+    regionNamespace = &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a",
+        Annotations: map[string]string{"secrets.aws.k8s/region": "eu-west-1"}}}
+)
+
+var mutatePodsCases = []mutatePodsCase{
+    /* pods that are mutated */
+    {name: "secret-arns", pod: goldenPod},
+    {name: "secret-names-default-region", pod: goldenNamedPod, defaultRegion: "us-east-1"},
+    {name: "secret-names-namespace-region", pod: goldenNamedPod, defaultRegion: "us-east-1", objects: []runtime.Object{regionNamespace, unannotatedServiceAccount}},
+    {name: "secret-names-pod-region", pod: strings.Replace(goldenNamedPod, "    secrets.aws.k8s/secretNames:", "    secrets.aws.k8s/region: ap-southeast-2\n    secrets.aws.k8s/secretNames:", 1), defaultRegion: "us-east-1"},
+    {name: "secret-names-no-region", pod: goldenNamedPod},
+    {name: "all-annotations", pod: strings.Replace(goldenPod, "    secrets.aws.k8s/secretArns:", `    secrets.aws.k8s/explodeJsonKeys: "true"
+    secrets.aws.k8s/roleArn: arn:aws:iam::210987654321:role/secrets
+    secrets.aws.k8s/externalId: team-a
+    secrets.aws.k8s/secretArns:`, 1)},
+    {name: "irsa", pod: goldenIRSAPod, objects: []runtime.Object{appServiceAccount}},
+    {name: "irsa-role-mismatch", pod: strings.Replace(goldenIRSAPod, "role/app\n", "role/other\n", 1), objects: []runtime.Object{appServiceAccount}},
+    {name: "irsa-container-role", pod: goldenIRSAPod, objects: []runtime.Object{unannotatedAppServiceAccount}},
+    {name: "irsa-no-client", pod: goldenIRSAPod, noClient: true},
+    {name: "irsa-projected", pod: goldenPod, objects: []runtime.Object{defaultServiceAccount}},
+    {name: "eks-pod-identity", pod: goldenPod + `    env:
+    - name: AWS_CONTAINER_CREDENTIALS_FULL_URI
+      value: http://169.254.170.23/v1/credentials
+    - name: AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE
+      value: /var/run/secrets/pods.eks.amazonaws.com/serviceaccount/eks-pod-identity-token
+    volumeMounts:
+    - name: eks-pod-identity-token
+      mountPath: /var/run/secrets/pods.eks.amazonaws.com/serviceaccount
+      readOnly: true
+  volumes:
+  - name: eks-pod-identity-token
+    projected:
+      sources:
+      - serviceAccountToken:
+          audience: pods.eks.amazonaws.com
+          expirationSeconds: 86400
+          path: eks-pod-identity-token
+`},
+    {name: "pre-existing-volume", pod: goldenPod + `    volumeMounts:
+    - name: secret-vol
+      mountPath: /secrets
+  volumes:
+  - name: secret-vol
+    emptyDir: {}
+`},
+    {name: "existing-init-containers", pod: goldenPod + `  initContainers:
+  - name: migrate
+    image: app:1
+    command: [migrate]
+`},
+    {name: "multiple-containers", pod: goldenPod + `  - name: proxy
+    image: proxy:1
+    volumeMounts:
+    - name: config
+      mountPath: /etc/proxy
+  volumes:
+  - name: config
+    configMap:
+      name: proxy
+`},
+    {name: "policy-allowed", pod: goldenNamedPod, defaultRegion: "us-east-1",
+        policy: "rules:\n- name: team-a\n  namespaces: [team-a]\n  secretNames: [team-a/*]\n"},
+    {name: "rules-audit", pod: goldenNamedPod, defaultRegion: "us-east-1",
+        rules: "mode: audit\nrules:\n- name: no-api\n  expression: \"secret.name != 'team-a/api'\"\n  message: the api secret is reserved\n"},
+
+    /* pods that are left alone */
+    {name: "not-annotated", pod: "metadata:\n  name: app\nspec:\n  containers:\n  - name: app\n    image: app:1\n"},
+    {name: "unsupported-injector", pod: strings.Replace(goldenPod, "injectorWebhook: init-container", "injectorWebhook: sidecar", 1)},
+    {name: "already-injected", pod: strings.Replace(goldenPod, "  annotations:\n", "  annotations:\n    secrets.aws.k8s/injected: \"true\"\n    secrets.aws.k8s/injectorVersion: v1.5\n", 1) +
+        "  initContainers:\n  - name: secrets-init-container\n    image: init:1\n"},
+    {name: "unexpected-resource", pod: goldenPod, resource: "deployments"},
+
+    /* pods that are denied */
+    {name: "undecodable-pod", raw: `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": "app"}}`},
+    {name: "invalid-annotations", pod: strings.Replace(goldenPod, "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-hlRvvF", "db", 1)},
+    {name: "init-container-conflict", pod: goldenPod + "  initContainers:\n  - name: secrets-init-container\n    image: init:1\n"},
+    {name: "namespace-lookup-failed", pod: goldenNamedPod, failGet: "namespaces"},
+    {name: "service-account-lookup-failed", pod: goldenPod, failGet: "serviceaccounts"},
+    {name: "policy-denied", pod: goldenNamedPod, defaultRegion: "us-east-1",
+        policy: "rules:\n- name: team-a\n  namespaces: [team-a]\n  secretNames: [team-a/db]\n"},
+    {name: "rules-denied", pod: goldenNamedPod, defaultRegion: "us-east-1",
+        rules: "rules:\n- name: no-api\n  expression: \"secret.name != 'team-a/api'\"\n  message: the api secret is reserved\n"},
+    {name: "irsa-role-not-found", pod: strings.Replace(goldenIRSAPod, "    - name: AWS_ROLE_ARN\n      value: arn:aws:iam::123456789012:role/app\n", "", 1),
+        objects: []runtime.Object{unannotatedAppServiceAccount}},
+    {name: "service-account-not-found", pod: goldenIRSAPod, objects: []runtime.Object{teamANamespace}},
+    {name: "namespace-not-found", pod: goldenNamedPod, objects: []runtime.Object{unannotatedServiceAccount}},
+    {name: "irsa-conflicting-roles", pod: strings.Replace(goldenIRSAPod, "  volumes:\n", `  - name: worker
+    image: app:1
+    env:
+    - name: AWS_ROLE_ARN
+      value: arn:aws:iam::123456789012:role/worker
+  volumes:
+`, 1), objects: []runtime.Object{unannotatedAppServiceAccount}},
+}
+
+// withMutatePodsCase sets up the cluster and configuration of a test case while a test runs.
+func withMutatePodsCase(t *testing.T, c mutatePodsCase) {
+    t.Helper()
+    saved := config
+    t.Cleanup(func() {
+        config = saved
+        clientset, policyFile, rulesFile = nil, nil, nil
+    })
+    config.InitContainerImage = "ghcr.io/ecrousseau/aws-secret-injector/init-container:test"
+    config.LogFormat = "json"
+    config.DefaultRegion = c.defaultRegion
+
+    objects := c.objects
+    if objects == nil {
+        objects = []runtime.Object{teamANamespace, unannotatedServiceAccount}
+    }
+    client := fake.NewSimpleClientset(objects...)
+    if c.failGet != "" {
+        client.PrependReactor("get", c.failGet, func(action k8stesting.Action) (bool, runtime.Object, error) {
+            return true, nil, errors.New("connection refused")
+        })
+    }
+    clientset = client
+    if c.noClient {
+        clientset = nil
+    }
+
+    dir, err := ioutil.TempDir("", "mutate-pods")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.RemoveAll(dir) })
+    if c.policy != "" {
+        path := filepath.Join(dir, "policy.yaml")
+        if err := ioutil.WriteFile(path, []byte(c.policy), 0600); err != nil {
+            t.Fatal(err)
+        }
+        policyFile = newPolicyFile(path)
+    }
+    if c.rules != "" {
+        path := filepath.Join(dir, "rules.yaml")
+        if err := ioutil.WriteFile(path, []byte(c.rules), 0600); err != nil {
+            t.Fatal(err)
+        }
+        rulesFile = newRulesFile(path)
+    }
+}
+
+// admitPod sends the test case's AdmissionReview to the webhook, and applies the patch it returns to the pod.
+func admitPod(t *testing.T, c mutatePodsCase) mutatePodsResult {
+    t.Helper()
+    object := []byte(c.raw)
+    if c.pod != "" {
+        var err error
+        if object, err = yaml.YAMLToJSON([]byte("apiVersion: v1\nkind: Pod\n" + strings.TrimPrefix(c.pod, "\n"))); err != nil {
+            t.Fatalf("test pod is not valid YAML: %v", err)
+        }
+    }
+    resource := "pods"
+    if c.resource != "" {
+        resource = c.resource
+    }
+    review := admission.AdmissionReview{
+        TypeMeta: meta.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+        Request: &admission.AdmissionRequest{
+            UID: "705ab4f5-6393-11e8-b7cc-42010a800002",
+            Kind: meta.GroupVersionKind{Version: "v1", Kind: "Pod"},
+            Resource: meta.GroupVersionResource{Version: "v1", Resource: resource},
+            Name: "app",
+            Namespace: "team-a",
+            Operation: admission.Create,
+            UserInfo: authentication.UserInfo{Username: "admin", Groups: []string{"system:authenticated"}},
+            Object: runtime.RawExtension{Raw: object},
+        },
+    }
+    body, err := json.Marshal(review)
+    if err != nil {
+        t.Fatal(err)
+    }
+    out := withAuditLog(t)
+    response := decodeAdmissionResponse(t, postMutatePods(body))
+
+    result := mutatePodsResult{Allowed: response.Allowed, Warnings: response.Warnings}
+    if events := decodeAuditEvents(t, out); len(events) == 1 {
+        result.Reason = events[0].Reason
+    }
+    if response.Result != nil {
+        result.Code, result.Message = response.Result.Code, response.Result.Message
+    }
+    if !response.Allowed {
+        if len(response.Patch) > 0 {
+            t.Errorf("expected no patch for a denied pod, got %s", response.Patch)
+        }
+        return result
+    }
+    if len(response.Patch) > 0 {
+        if response.PatchType == nil || *response.PatchType != admission.PatchTypeJSONPatch {
+            t.Fatalf("expected a JSONPatch, got patch type %v", response.PatchType)
+        }
+        patch, err := jsonpatch.DecodePatch(response.Patch)
+        if err != nil {
+            t.Fatalf("response patch is not a JSON patch: %v", err)
+        }
+        if object, err = patch.Apply(object); err != nil {
+            t.Fatalf("response patch does not apply to the pod: %v\n%s", err, response.Patch)
+        }
+    }
+    if err := json.Unmarshal(object, &result.Pod); err != nil {
+        t.Fatal(err)
+    }
+    return result
+}
+
+// TestMutatePodsGolden checks the pods produced by the webhook against golden files. Run
+// go test -run TestMutatePodsGolden -update to regenerate them after changing what the webhook does.
+func TestMutatePodsGolden(t *testing.T) {
+    for _, c := range mutatePodsCases {
+        c := c
+        t.Run(c.name, func(t *testing.T) {
+            withMutatePodsCase(t, c)
+            actual, err := yaml.Marshal(admitPod(t, c))
+            if err != nil {
+                t.Fatal(err)
+            }
+            golden := filepath.Join("testdata", "mutate-pods", c.name+".yaml")
+            if *update {
+                if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+                    t.Fatal(err)
+                }
+                if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+                    t.Fatal(err)
+                }
+                return
+            }
+            expected, err := ioutil.ReadFile(golden)
+            if err != nil {
+                t.Fatalf("%v (run go test -update to create it)", err)
+            }
+            if string(expected) != string(actual) {
+                diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+                    A: difflib.SplitLines(string(expected)),
+                    B: difflib.SplitLines(string(actual)),
+                    FromFile: golden,
+                    ToFile: "actual",
+                    Context: 3,
+                })
+                t.Errorf("result does not match the golden file (run go test -update if the change is intended):\n%s", diff)
+            }
+        })
+    }
+}
+
+// TestMutatePodsGoldenFiles makes sure every golden file belongs to a test case, so renamed cases do not leave
+// stale files behind.
+func TestMutatePodsGoldenFiles(t *testing.T) {
+    names := map[string]bool{}
+    for _, c := range mutatePodsCases {
+        if names[c.name] {
+            t.Errorf("duplicate test case %s", c.name)
+        }
+        names[c.name] = true
+    }
+    files, err := filepath.Glob(filepath.Join("testdata", "mutate-pods", "*.yaml"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, file := range files {
+        if name := strings.TrimSuffix(filepath.Base(file), ".yaml"); !names[name] {
+            t.Errorf("golden file %s has no test case", file)
+        }
+    }
+}
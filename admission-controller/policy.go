@@ -0,0 +1,241 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strings"
+    "sync"
+
+    authentication "k8s.io/api/authentication/v1"
+    core "k8s.io/api/core/v1"
+    "k8s.io/klog/v2"
+    "sigs.k8s.io/yaml"
+)
+
+// Policy restricts which secrets the pods in each namespace (and service account) may request.
+type Policy struct {
+    Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule allows pods matching the namespace and service account patterns to request secrets matching
+// the secret ARN and name patterns. Patterns may contain '*' wildcards, which also match '/'.
+type PolicyRule struct {
+    Name string `json:"name"`
+    Namespaces []string `json:"namespaces"`
+    ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+    SecretArns []string `json:"secretArns,omitempty"`
+    SecretNames []string `json:"secretNames,omitempty"`
+    namespaces wildcardPatterns
+    serviceAccounts wildcardPatterns
+    secretArns wildcardPatterns
+    secretNames wildcardPatterns
+}
+
+// wildcardPatterns are patterns containing '*' wildcards, compiled to regular expressions.
+type wildcardPatterns []*regexp.Regexp
+
+// PolicyFile caches the policy read from a file, re-reading it when the file changes.
+type PolicyFile struct {
+    file WatchedFile
+    mutex sync.Mutex
+    policy *Policy
+    err error
+}
+
+var (
+    policyFile *PolicyFile
+)
+
+// newPolicyFile creates a PolicyFile for the given path.
+func newPolicyFile(path string) *PolicyFile {
+    return &PolicyFile{file: WatchedFile{path: path}}
+}
+
+// load returns the current policy, re-reading the file if it has been modified.
+func (f *PolicyFile) load() (*Policy, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    data, changed, err := f.file.readIfChanged()
+    if err != nil {
+        return nil, fmt.Errorf("Unable to read secret access policy %s: %v", f.file.path, err)
+    }
+    if !changed {
+        return f.policy, f.err
+    }
+    policy, err := compilePolicy(data)
+    if err != nil {
+        f.policy, f.err = nil, fmt.Errorf("Unable to parse secret access policy %s: %v", f.file.path, err)
+        return f.policy, f.err
+    }
+    klog.Info("Loaded secret access policy from ", f.file.path, " with ", len(policy.Rules), " rules")
+    f.policy, f.err = policy, nil
+    return f.policy, f.err
+}
+
+// compilePolicy parses a policy and compiles its patterns, so that they are not compiled again for every pod.
+func compilePolicy(data []byte) (*Policy, error) {
+    policy := Policy{}
+    if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+        return nil, err
+    }
+    for i := range policy.Rules {
+        rule := &policy.Rules[i]
+        rule.namespaces = compileWildcards(rule.Namespaces)
+        rule.serviceAccounts = compileWildcards(rule.ServiceAccounts)
+        rule.secretArns = compileWildcards(rule.SecretArns)
+        rule.secretNames = compileWildcards(rule.SecretNames)
+    }
+    return &policy, nil
+}
+
+// evaluatePolicy checks the secrets requested by a pod against the secret access policy, if one is configured.
+func evaluatePolicy(namespace string, serviceAccount string, secretArns []string, secretNames []string, log requestLogger) error {
+    if policyFile == nil {
+        return nil
+    }
+    policy, err := policyFile.load()
+    if err != nil {
+        log.error(err, "Unable to load secret access policy")
+        return internalError(deniedInternalError, fmt.Errorf("Secret access policy could not be loaded, so no secrets can be injected"))
+    }
+    if err := policy.evaluate(namespace, serviceAccount, secretArns, secretNames); err != nil {
+        return forbidden(deniedPolicy, err)
+    }
+    log.info("Secret access policy allows the secrets")
+    return nil
+}
+
+// PolicyDecision is the outcome of the secret access policy and of the secret injection rules for a pod, as
+// recorded in the audit log.
+type PolicyDecision struct {
+    Policy string `json:"policy"`
+    Rules string `json:"rules"`
+}
+
+const (
+    decisionNotEvaluated = "not_evaluated"
+    decisionDisabled = "disabled"
+    decisionAllowed = "allowed"
+    decisionWarned = "warned" /* allowed, but rules in audit mode failed */
+    decisionDenied = "denied"
+    decisionError = "error"
+)
+
+// checkSecretAccess checks the secrets requested by a pod against both the secret access policy and the
+// secret injection rules.
+func checkSecretAccess(pod core.Pod, secretAnnotations *SecretAnnotations, region string, userInfo authentication.UserInfo, log requestLogger) (PolicyDecision, []string, error) {
+    decision := PolicyDecision{Policy: decisionDisabled, Rules: decisionDisabled}
+    if policyFile != nil {
+        decision.Policy = decisionAllowed
+    }
+    if err := evaluatePolicy(pod.ObjectMeta.Namespace, pod.Spec.ServiceAccountName, secretAnnotations.SecretArns, secretAnnotations.SecretNames, log); err != nil {
+        decision.Policy, decision.Rules = decisionFor(err), decisionNotEvaluated
+        return decision, nil, err
+    }
+    if rulesFile != nil {
+        decision.Rules = decisionAllowed
+    }
+    warnings, err := evaluateRules(pod, secretReferences(secretAnnotations.SecretArns, secretAnnotations.SecretNames, region), userInfo, log)
+    if err != nil {
+        decision.Rules = decisionFor(err)
+    } else if len(warnings) > 0 {
+        decision.Rules = decisionWarned
+    }
+    return decision, warnings, err
+}
+
+// decisionFor distinguishes a denial from a failure to evaluate the policy or rules.
+func decisionFor(err error) string {
+    var e *admissionError
+    if errors.As(err, &e) && e.code == http.StatusInternalServerError {
+        return decisionError
+    }
+    return decisionDenied
+}
+
+// evaluate checks that every secret is allowed by at least one rule that applies to the namespace and
+// service account. Anything that is not explicitly allowed is denied.
+func (p *Policy) evaluate(namespace string, serviceAccount string, secretArns []string, secretNames []string) error {
+    if serviceAccount == "" {
+        serviceAccount = "default"
+    }
+    var rules []PolicyRule
+    for _, rule := range p.Rules {
+        if rule.namespaces.matches(namespace) && (len(rule.serviceAccounts) == 0 || rule.serviceAccounts.matches(serviceAccount)) {
+            rules = append(rules, rule)
+        }
+    }
+    if len(rules) == 0 {
+        return fmt.Errorf("Secret access policy has no rules for service account %s in namespace %s", serviceAccount, namespace)
+    }
+    for _, secretArn := range secretArns {
+        if !policyAllows(rules, func(rule PolicyRule) wildcardPatterns { return rule.secretArns }, secretArn) {
+            return fmt.Errorf("Secret access policy does not allow service account %s in namespace %s to use secret ARN %s (rules checked: %s)", serviceAccount, namespace, secretArn, ruleNames(rules))
+        }
+    }
+    for _, secretName := range secretNames {
+        if !policyAllows(rules, func(rule PolicyRule) wildcardPatterns { return rule.secretNames }, secretName) {
+            return fmt.Errorf("Secret access policy does not allow service account %s in namespace %s to use secret name %s (rules checked: %s)", serviceAccount, namespace, secretName, ruleNames(rules))
+        }
+    }
+    return nil
+}
+
+func policyAllows(rules []PolicyRule, patterns func(PolicyRule) wildcardPatterns, value string) bool {
+    for _, rule := range rules {
+        if patterns(rule).matches(value) {
+            return true
+        }
+    }
+    return false
+}
+
+func ruleNames(rules []PolicyRule) string {
+    var names []string
+    for _, rule := range rules {
+        if rule.Name != "" {
+            names = append(names, rule.Name)
+        } else {
+            names = append(names, "(unnamed)")
+        }
+    }
+    return strings.Join(names, ", ")
+}
+
+// compileWildcards compiles patterns containing '*' wildcards, which match any characters including '/'.
+func compileWildcards(patterns []string) wildcardPatterns {
+    compiled := make(wildcardPatterns, 0, len(patterns))
+    for _, pattern := range patterns {
+        expression := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$"
+        compiled = append(compiled, regexp.MustCompile(expression))
+    }
+    return compiled
+}
+
+// matches checks whether value matches any of the patterns.
+func (p wildcardPatterns) matches(value string) bool {
+    for _, pattern := range p {
+        if pattern.MatchString(value) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestWildcardPatterns(t *testing.T) {
+    tests := []struct {
+        patterns []string
+        value string
+        expected bool
+    }{
+        {[]string{"team-a"}, "team-a", true},
+        {[]string{"team-a"}, "team-ab", false},
+        {[]string{"team-a"}, "my-team-a", false},
+        {[]string{"team-*"}, "team-a", true},
+        {[]string{"team-*"}, "team-", true},
+        {[]string{"team-*"}, "teams", false},
+        {[]string{"*"}, "anything/at/all", true},
+        {[]string{"team-a/*"}, "team-a/db/password", true},
+        {[]string{"*/db"}, "team-a/db", true},
+        {[]string{"*/db"}, "team-a/db2", false},
+        {[]string{"arn:aws:secretsmanager:*:123456789012:secret:team-a/*"}, "arn:aws:secretsmanager:us-east-1:123456789012:secret:team-a/db-hlRvvF", true},
+        {[]string{"arn:aws:secretsmanager:*:123456789012:secret:team-a/*"}, "arn:aws:secretsmanager:us-east-1:210987654321:secret:team-a/db", false},
+        {[]string{"db.prod"}, "dbxprod", false}, /* regular expression characters are literal */
+        {[]string{"db[1]"}, "db[1]", true},
+        {[]string{"team-b", "team-a"}, "team-a", true},
+        {nil, "team-a", false},
+    }
+    for _, test := range tests {
+        if actual := compileWildcards(test.patterns).matches(test.value); actual != test.expected {
+            t.Errorf("expected %q matching %q to be %v", test.patterns, test.value, test.expected)
+        }
+    }
+}
+
+const testPolicy = `
+rules:
+- name: team-a
+  namespaces: [team-a]
+  secretNames: [team-a/*]
+  secretArns: ["arn:aws:secretsmanager:*:123456789012:secret:team-a/*"]
+- name: team-a-batch
+  namespaces: [team-a]
+  serviceAccounts: [batch]
+  secretNames: [shared/batch-*]
+- name: teams
+  namespaces: ["team-*"]
+  secretNames: [shared/public]
+`
+
+func TestPolicyEvaluate(t *testing.T) {
+    policy, err := compilePolicy([]byte(testPolicy))
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        namespace string
+        serviceAccount string
+        secretArns []string
+        secretNames []string
+        err string
+    }{
+        {name: "allowed name", namespace: "team-a", secretNames: []string{"team-a/db"}},
+        {name: "allowed ARN", namespace: "team-a", secretArns: []string{"arn:aws:secretsmanager:eu-west-1:123456789012:secret:team-a/db-hlRvvF"}},
+        {name: "allowed by different rules", namespace: "team-a", serviceAccount: "batch", secretNames: []string{"team-a/db", "shared/batch-token", "shared/public"}},
+        {name: "any matching namespace", namespace: "team-b", secretNames: []string{"shared/public"}},
+        {name: "no rules for the namespace", namespace: "other", secretNames: []string{"shared/public"},
+            err: "has no rules for service account default in namespace other"},
+        {name: "rule for another service account", namespace: "team-a", secretNames: []string{"shared/batch-token"},
+            err: "does not allow service account default in namespace team-a to use secret name shared/batch-token (rules checked: team-a, teams)"},
+        {name: "secret of another team", namespace: "team-b", secretNames: []string{"team-a/db"},
+            err: "does not allow service account default in namespace team-b to use secret name team-a/db (rules checked: teams)"},
+        {name: "ARN in another account", namespace: "team-a", secretArns: []string{"arn:aws:secretsmanager:us-east-1:210987654321:secret:team-a/db"},
+            err: "to use secret ARN arn:aws:secretsmanager:us-east-1:210987654321:secret:team-a/db"},
+        {name: "names are not ARNs", namespace: "team-a", secretArns: []string{"team-a/db"}, err: "to use secret ARN team-a/db"},
+        {name: "one denied secret denies the pod", namespace: "team-a", secretNames: []string{"team-a/db", "team-b/db"}, err: "to use secret name team-b/db"},
+    }
+    for _, test := range tests {
+        err := policy.evaluate(test.namespace, test.serviceAccount, test.secretArns, test.secretNames)
+        if test.err == "" && err != nil {
+            t.Errorf("%s: unexpected error: %v", test.name, err)
+        } else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+            t.Errorf("%s: expected an error containing %q, got %v", test.name, test.err, err)
+        }
+    }
+}
+
+func TestCompilePolicyInvalid(t *testing.T) {
+    for _, data := range []string{"rules: {}\n", "rules:\n- name: a\n  namespace: [team-a]\n", "rules: [\n"} {
+        if _, err := compilePolicy([]byte(data)); err == nil {
+            t.Errorf("expected an error for policy %q", data)
+        }
+    }
+}
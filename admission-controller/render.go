@@ -0,0 +1,476 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "strings"
+
+    jsonpatch "github.com/evanphx/json-patch"
+    "github.com/go-logr/logr"
+    "github.com/pmezard/go-difflib/difflib"
+    admission "k8s.io/api/admission/v1"
+    authentication "k8s.io/api/authentication/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/klog/v2"
+    "sigs.k8s.io/yaml"
+)
+
+// Exit codes of the render command.
+const (
+    renderOK = 0
+    renderDenied = 1
+    renderInvalid = 2
+)
+
+const renderUsage = `Usage: admission-controller render [flags] [file ...]
+
+Shows how the admission controller would mutate the pods in Kubernetes manifests, without a cluster. Pods and
+the pod templates of Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and CronJobs are mutated as if
+they were being created; other objects are printed unchanged. Manifests are read from the files, or from stdin
+if there are none or a file is -.
+
+Namespaces and service accounts are not looked up, so their annotations (e.g. secrets.aws.k8s/region and
+eks.amazonaws.com/role-arn) are not taken into account.
+
+Exit status is 0 if every pod would be admitted, 1 if any would be denied and 2 if the manifests or flags are
+invalid.
+
+Flags:
+`
+
+// renderOptions are the settings of the render command.
+type renderOptions struct {
+    namespace string
+    username string
+    groups string
+    output string
+    verbose bool
+    explain bool
+    namespaceLabels map[string]string
+}
+
+// renderedObject is an object from a manifest, and the object after its pods were mutated.
+type renderedObject struct {
+    description string
+    original []byte
+    mutated []byte
+    explanation *Explanation
+}
+
+// runRender runs the render command with its command line arguments, returning the exit status.
+func runRender(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    options := renderOptions{}
+    flags := flag.NewFlagSet("render", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    flags.Usage = func() {
+        fmt.Fprint(stderr, renderUsage)
+        flags.PrintDefaults()
+    }
+    flags.StringVar(&options.namespace, "namespace", "default",
+        "Namespace of objects that do not set one.")
+    flags.StringVar(&options.username, "username", "render",
+        "User the objects are created by, for the secret access policy and rules.")
+    flags.StringVar(&options.groups, "groups", "system:authenticated",
+        "Comma-separated list of the groups of the user the objects are created by.")
+    flags.StringVar(&options.output, "output", "yaml",
+        "Output format: yaml or json for the mutated manifests, or diff for a unified diff of the changes.")
+    flags.BoolVar(&options.explain, "explain", false,
+        "Explain what would happen to each pod, step by step, instead of printing the mutated manifests.")
+    namespaceLabels := flags.String("namespace-labels", "secret-injection=enabled",
+        "Comma-separated key=value labels of the namespace, for the webhook's namespaceSelector when --explain is set.")
+    flags.BoolVar(&options.verbose, "v", false,
+        "Log how each pod is handled to stderr, as the admission controller does.")
+    flags.StringVar(&config.InitContainerImage, "init-container-image", "ghcr.io/ecrousseau/aws-secret-injector/init-container:latest",
+        "Image to be used for the init container")
+    flags.StringVar(&config.DefaultRegion, "default-region", config.DefaultRegion,
+        "AWS region for secrets listed by name, when the pod has no secrets.aws.k8s/region annotation.")
+    flags.StringVar(&config.PolicyFile, "policy-file", config.PolicyFile,
+        "File containing the secret access policy. If not set, pods may request any secret.")
+    flags.StringVar(&config.RulesFile, "rules-file", config.RulesFile,
+        "File containing CEL rules that are evaluated for each secret a pod requests.")
+    flags.StringVar(&config.LogFormat, "log-format", "text",
+        "Log format of the admission controller, which the init container is configured to use.")
+    if err := flags.Parse(args); err != nil {
+        return renderInvalid
+    }
+    if options.output != "yaml" && options.output != "json" && (options.output != "diff" || options.explain) {
+        fmt.Fprintf(stderr, "Unsupported output format %q (expected yaml, json or diff, or yaml or json with --explain)\n", options.output)
+        return renderInvalid
+    }
+    labels, err := labels.ConvertSelectorToLabelsMap(*namespaceLabels)
+    if err != nil {
+        fmt.Fprintf(stderr, "Invalid --namespace-labels: %v\n", err)
+        return renderInvalid
+    }
+    options.namespaceLabels = labels
+
+    if err := setupCommand(options.verbose); err != nil {
+        fmt.Fprintln(stderr, err)
+        return renderInvalid
+    }
+
+    paths := flags.Args()
+    if len(paths) == 0 {
+        paths = []string{"-"}
+    }
+    var documents []manifestDocument
+    for _, path := range paths {
+        fileDocuments, err := readManifestFile(path, stdin)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            return renderInvalid
+        }
+        documents = append(documents, fileDocuments...)
+    }
+    status := renderOK
+    var objects []renderedObject
+    for _, document := range documents {
+        rendered, err := renderManifest(document.data, options, stderr)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            return renderInvalid
+        }
+        for _, object := range rendered {
+            switch {
+            case options.explain && object.explanation == nil:
+                continue /* not a pod or workload */
+            case options.explain && object.explanation.Outcome == "denied":
+                status = renderDenied
+            case !options.explain && object.mutated == nil:
+                status = renderDenied
+                continue
+            }
+            objects = append(objects, object)
+        }
+    }
+    write := writeRendered
+    if options.explain {
+        write = writeExplanations
+    }
+    if err := write(stdout, objects, options.output); err != nil {
+        fmt.Fprintln(stderr, err)
+        return renderInvalid
+    }
+    return status
+}
+
+// renderManifest mutates the pods in a manifest, which may be a List of objects. Objects whose pods would be
+// denied are returned without a mutated version, after the reason is written to stderr.
+func renderManifest(data []byte, options renderOptions, stderr io.Writer) ([]renderedObject, error) {
+    object := map[string]interface{}{}
+    if err := json.Unmarshal(data, &object); err != nil {
+        return nil, fmt.Errorf("Manifest is not an object: %v", err)
+    }
+    kind, _ := object["kind"].(string)
+    if kind == "" {
+        return nil, fmt.Errorf("Manifest has no kind: %s", data)
+    }
+    if strings.HasSuffix(kind, "List") {
+        items, _ := object["items"].([]interface{})
+        var objects []renderedObject
+        for _, item := range items {
+            itemData, err := json.Marshal(item)
+            if err != nil {
+                return nil, err
+            }
+            rendered, err := renderManifest(itemData, options, stderr)
+            if err != nil {
+                return nil, err
+            }
+            objects = append(objects, rendered...)
+        }
+        return objects, nil
+    }
+
+    metadata, _ := object["metadata"].(map[string]interface{})
+    name, _ := metadata["name"].(string)
+    namespace, _ := metadata["namespace"].(string)
+    if namespace == "" {
+        namespace = options.namespace
+    }
+    rendered := renderedObject{description: kind + "/" + name, original: data}
+    if kind == "Pod" {
+        if options.explain {
+            return []renderedObject{explainRendered(rendered, data, name, namespace, options)}, nil
+        }
+        response, mutated, err := renderPod(data, name, namespace, options)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %v", rendered.description, err)
+        }
+        if reportResponse(stderr, rendered.description, response) {
+            rendered.mutated = mutated
+        }
+        return []renderedObject{rendered}, nil
+    }
+    path, ok := podTemplatePaths[kind]
+    if !ok {
+        rendered.mutated = data
+        return []renderedObject{rendered}, nil
+    }
+
+    /* mutate the pod template as a pod, and put the result back in the workload */
+    parent := object
+    for _, field := range path[:len(path)-1] {
+        if parent, ok = parent[field].(map[string]interface{}); !ok {
+            return nil, fmt.Errorf("%s: %s has no pod template", rendered.description, kind)
+        }
+    }
+    template, ok := parent[path[len(path)-1]].(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("%s: %s has no pod template", rendered.description, kind)
+    }
+    pod, err := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "Pod", "metadata": template["metadata"], "spec": template["spec"]})
+    if err != nil {
+        return nil, err
+    }
+    if options.explain {
+        return []renderedObject{explainRendered(rendered, pod, "", namespace, options)}, nil
+    }
+    response, mutatedPod, err := renderPod(pod, "", namespace, options)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", rendered.description, err)
+    }
+    if !reportResponse(stderr, rendered.description, response) {
+        return []renderedObject{rendered}, nil
+    }
+    mutatedTemplate := map[string]interface{}{}
+    if err := json.Unmarshal(mutatedPod, &mutatedTemplate); err != nil {
+        return nil, err
+    }
+    template["metadata"], template["spec"] = mutatedTemplate["metadata"], mutatedTemplate["spec"]
+    if rendered.mutated, err = json.Marshal(object); err != nil {
+        return nil, err
+    }
+    return []renderedObject{rendered}, nil
+}
+
+// explainRendered explains what would happen to the pod of an object (or its pod template), instead of rendering
+// it. The webhook is assumed to have the Helm chart's selectors, and the namespace labels are those given with
+// --namespace-labels, so the explanation is hypothetical.
+func explainRendered(rendered renderedObject, pod []byte, name string, namespace string, options renderOptions) renderedObject {
+    userInfo := commandUser(options.username, options.groups)
+    rendered.explanation = explainPod(pod, name, namespace, options.namespaceLabels, true, userInfo, defaultWebhookSelectors)
+    if rendered.explanation.Pod == "" {
+        rendered.explanation.Pod = rendered.description
+    }
+    return rendered
+}
+
+// setupCommand configures logging for the render and lint commands, which only log with -v and run offline, and loads the
+// secret access policy and rules.
+func setupCommand(verbose bool) error {
+    if verbose {
+        if err := setupLogging("text", nil); err != nil {
+            return err
+        }
+    } else {
+        klog.SetLogger(logr.Discard())
+    }
+    offline = true
+    if config.PolicyFile != "" {
+        policyFile = newPolicyFile(config.PolicyFile)
+        if _, err := policyFile.load(); err != nil {
+            return err
+        }
+    }
+    if config.RulesFile != "" {
+        rulesFile = newRulesFile(config.RulesFile)
+        if _, err := rulesFile.load(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// commandUser is the user that the render and lint commands create objects as, from a comma-separated list
+// of groups.
+func commandUser(username string, groups string) authentication.UserInfo {
+    userInfo := authentication.UserInfo{Username: username}
+    if groups != "" {
+        userInfo.Groups = splitList(groups)
+    }
+    return userInfo
+}
+
+// renderPod sends a pod to mutatePods in a synthetic AdmissionReview, as the API server would when it is
+// created, and applies the patch in the response.
+func renderPod(pod []byte, name string, namespace string, options renderOptions) (*admission.AdmissionResponse, []byte, error) {
+    review := admission.AdmissionReview{
+        Request: &admission.AdmissionRequest{
+            UID: types.UID("render"),
+            Kind: meta.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+            Resource: meta.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"},
+            Name: name,
+            Namespace: namespace,
+            Operation: admission.Create,
+            UserInfo: commandUser(options.username, options.groups),
+            Object: runtime.RawExtension{Raw: pod},
+            DryRun: &True,
+        },
+    }
+    response := mutatePods(review)
+    if !response.Allowed || len(response.Patch) == 0 {
+        return response, pod, nil
+    }
+    patch, err := jsonpatch.DecodePatch(response.Patch)
+    if err != nil {
+        return nil, nil, fmt.Errorf("Invalid patch: %v", err)
+    }
+    mutated, err := patch.Apply(pod)
+    if err != nil {
+        return nil, nil, fmt.Errorf("Unable to apply patch %s: %v", response.Patch, err)
+    }
+    return response, mutated, nil
+}
+
+// reportResponse writes the warnings in an admission response to stderr, and the reason if it was denied, in
+// the same way as kubectl. It returns whether the object was allowed.
+func reportResponse(stderr io.Writer, description string, response *admission.AdmissionResponse) bool {
+    for _, warning := range response.Warnings {
+        fmt.Fprintf(stderr, "Warning: %s: %s\n", description, warning)
+    }
+    if response.Allowed {
+        return true
+    }
+    message := "denied"
+    if response.Result != nil && response.Result.Message != "" {
+        message = response.Result.Message
+    }
+    fmt.Fprintf(stderr, "Error: %s: %s\n", description, message)
+    return false
+}
+
+// writeRendered writes the mutated objects as YAML documents, as JSON (a List if there is more than one
+// object), or as a unified diff of the changes.
+func writeRendered(out io.Writer, objects []renderedObject, output string) error {
+    switch output {
+    case "json":
+        var data []byte
+        if len(objects) == 1 {
+            data = objects[0].mutated
+        } else {
+            items := make([]json.RawMessage, 0, len(objects))
+            for _, object := range objects {
+                items = append(items, object.mutated)
+            }
+            list, err := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+            if err != nil {
+                return err
+            }
+            data = list
+        }
+        var indented bytes.Buffer
+        if err := json.Indent(&indented, data, "", "  "); err != nil {
+            return err
+        }
+        _, err := fmt.Fprintln(out, indented.String())
+        return err
+    case "diff":
+        for _, object := range objects {
+            original, err := yaml.JSONToYAML(object.original)
+            if err != nil {
+                return err
+            }
+            mutated, err := yaml.JSONToYAML(object.mutated)
+            if err != nil {
+                return err
+            }
+            diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+                A: splitLines(string(original)),
+                B: splitLines(string(mutated)),
+                FromFile: object.description + " (original)",
+                ToFile: object.description + " (mutated)",
+                Context: 3,
+            })
+            if err != nil {
+                return err
+            }
+            if _, err := io.WriteString(out, diff); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    for i, object := range objects {
+        data, err := yaml.JSONToYAML(object.mutated)
+        if err != nil {
+            return err
+        }
+        if i > 0 {
+            if _, err := io.WriteString(out, "---\n"); err != nil {
+                return err
+            }
+        }
+        if _, err := out.Write(data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// splitLines splits text into lines for a diff, keeping the line endings.
+func splitLines(text string) []string {
+    lines := strings.SplitAfter(text, "\n")
+    if lines[len(lines)-1] == "" {
+        lines = lines[:len(lines)-1]
+    }
+    return lines
+}
+
+// writeExplanations writes the explanations of the pods as YAML documents, or as JSON (an array if there is more
+// than one).
+func writeExplanations(out io.Writer, objects []renderedObject, output string) error {
+    explanations := make([]*Explanation, 0, len(objects))
+    for _, object := range objects {
+        explanations = append(explanations, object.explanation)
+    }
+    if output == "json" {
+        var value interface{} = explanations
+        if len(explanations) == 1 {
+            value = explanations[0]
+        }
+        data, err := json.MarshalIndent(value, "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(out, string(data))
+        return err
+    }
+    for i, explanation := range explanations {
+        data, err := yaml.Marshal(explanation)
+        if err != nil {
+            return err
+        }
+        if i > 0 {
+            if _, err := io.WriteString(out, "---\n"); err != nil {
+                return err
+            }
+        }
+        if _, err := out.Write(data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
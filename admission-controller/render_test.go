@@ -0,0 +1,149 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "k8s.io/klog/v2"
+)
+
+const renderManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: team-a
+spec:
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+      annotations:
+        secrets.aws.k8s/injectorWebhook: init-container
+        secrets.aws.k8s/secretNames: db
+    spec:
+      containers:
+      - name: app
+        image: app:1
+`
+
+// render runs the render command on the manifests, returning its exit status, stdout and stderr.
+func render(t *testing.T, manifests string, args ...string) (int, string, string) {
+    t.Helper()
+    saved := config
+    defer func() {
+        config = saved
+        offline = false
+        klog.SetLogger(nil)
+    }()
+    var stdout, stderr bytes.Buffer
+    status := runRender(args, strings.NewReader(manifests), &stdout, &stderr)
+    return status, stdout.String(), stderr.String()
+}
+
+func TestRenderWorkload(t *testing.T) {
+    status, stdout, stderr := render(t, renderManifests, "-default-region", "us-east-1", "-init-container-image", "init:1")
+    if status != renderOK {
+        t.Fatalf("expected exit status %d, got %d: %s", renderOK, status, stderr)
+    }
+    documents := strings.Split(stdout, "---\n")
+    if len(documents) != 2 {
+        t.Fatalf("expected 2 documents, got %d:\n%s", len(documents), stdout)
+    }
+    if !strings.Contains(documents[0], "kind: ConfigMap") || strings.Contains(documents[0], "secrets-init-container") {
+        t.Errorf("expected the ConfigMap to be unchanged, got:\n%s", documents[0])
+    }
+    for _, expected := range []string{"name: secrets-init-container", "image: init:1", "value: us-east-1", "mountPath: /injected-secrets", "secrets.aws.k8s/injected: \"true\"", "medium: Memory"} {
+        if !strings.Contains(documents[1], expected) {
+            t.Errorf("expected the Deployment to contain %q, got:\n%s", expected, documents[1])
+        }
+    }
+}
+
+func TestRenderDiff(t *testing.T) {
+    status, stdout, stderr := render(t, renderManifests, "-output", "diff", "-default-region", "us-east-1")
+    if status != renderOK {
+        t.Fatalf("expected exit status %d, got %d: %s", renderOK, status, stderr)
+    }
+    if strings.Contains(stdout, "ConfigMap") {
+        t.Errorf("expected no diff for the ConfigMap, got:\n%s", stdout)
+    }
+    for _, expected := range []string{"--- Deployment/app (original)\n", "+++ Deployment/app (mutated)\n", "+      initContainers:\n", "+        secrets.aws.k8s/injected: \"true\"\n", "         secrets.aws.k8s/secretNames: db\n"} {
+        if !strings.Contains(stdout, expected) {
+            t.Errorf("expected the diff to contain %q, got:\n%s", expected, stdout)
+        }
+    }
+}
+
+func TestRenderDenied(t *testing.T) {
+    pod := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "bad", "annotations": {"secrets.aws.k8s/injectorWebhook": "init-container"}},
+        "spec": {"containers": [{"name": "app", "image": "app:1"}]}}`
+    status, stdout, stderr := render(t, pod, "-output", "json")
+    if status != renderDenied {
+        t.Errorf("expected exit status %d, got %d", renderDenied, status)
+    }
+    if !strings.Contains(stderr, "Error: Pod/bad: ") {
+        t.Errorf("expected the reason the pod was denied, got %q", stderr)
+    }
+    if strings.Contains(stdout, "bad") {
+        t.Errorf("expected the denied pod not to be printed, got %q", stdout)
+    }
+}
+
+func TestRenderInvalid(t *testing.T) {
+    if status, _, _ := render(t, renderManifests, "-output", "xml"); status != renderInvalid {
+        t.Errorf("expected exit status %d for an unsupported output format, got %d", renderInvalid, status)
+    }
+    if status, _, _ := render(t, "data: {}\n"); status != renderInvalid {
+        t.Errorf("expected exit status %d for a manifest without a kind, got %d", renderInvalid, status)
+    }
+}
+
+func TestRenderExplain(t *testing.T) {
+    status, stdout, stderr := render(t, renderManifests, "-explain", "-output", "json", "-default-region", "us-east-1")
+    if status != renderOK {
+        t.Fatalf("expected exit status %d, got %d: %s", renderOK, status, stderr)
+    }
+    explanation := Explanation{}
+    if err := json.Unmarshal([]byte(stdout), &explanation); err != nil {
+        t.Fatalf("expected a single explanation, got %v:\n%s", err, stdout)
+    }
+    if explanation.Pod != "Deployment/app" || explanation.Outcome != "mutated" || len(explanation.Patch) == 0 {
+        t.Errorf("expected the Deployment's pod to be mutated, got %+v", explanation)
+    }
+
+    status, stdout, _ = render(t, renderManifests, "-explain", "-namespace-labels", "team=a")
+    if status != renderOK || !strings.Contains(stdout, "outcome: not_selected") {
+        t.Errorf("expected the namespace not to be selected, got %d:\n%s", status, stdout)
+    }
+    if status, _, _ := render(t, renderManifests, "-explain", "-output", "diff"); status != renderInvalid {
+        t.Errorf("expected exit status %d for a diff with -explain, got %d", renderInvalid, status)
+    }
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+// SecretRole is the role the init container assumes before retrieving a secret.
+type SecretRole struct {
+    RoleArn string `json:"roleArn"`
+    ExternalId string `json:"externalId,omitempty"`
+}
+
+// parseSecretRoles parses the secrets.aws.k8s/secretRoles annotation, which maps secrets (as listed in
+// secrets.aws.k8s/secretArns or secrets.aws.k8s/secretNames) to the role to assume for each of them.
+func parseSecretRoles(annotation string, secrets []string) (map[string]SecretRole, error) {
+    var secretRoles map[string]SecretRole
+    if err := json.Unmarshal([]byte(annotation), &secretRoles); err != nil {
+        return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretRoles could not be parsed as JSON: %v", err)
+    }
+    for secret, role := range secretRoles {
+        if !containsString(secrets, secret) {
+            return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretRoles refers to secret %q, which is not one of the secrets to be injected", secret)
+        }
+        if role.RoleArn == "" {
+            return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretRoles has no roleArn for secret %q", secret)
+        }
+        if err := validateRoleArn(role.RoleArn); err != nil {
+            return nil, fmt.Errorf("Pod annotation secrets.aws.k8s/secretRoles has an invalid roleArn for secret %q: %v", secret, err)
+        }
+    }
+    return secretRoles, nil
+}
+
+// splitList splits a comma-separated annotation value in the same way as the init container, ignoring any
+// spaces around the elements.
+func splitList(value string) []string {
+    var elements []string
+    for _, element := range strings.Split(value, ",") {
+        elements = append(elements, strings.TrimSpace(element))
+    }
+    return elements
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
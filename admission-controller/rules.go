@@ -0,0 +1,232 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/google/cel-go/cel"
+    "github.com/google/cel-go/checker/decls"
+    authentication "k8s.io/api/authentication/v1"
+    core "k8s.io/api/core/v1"
+    "k8s.io/klog/v2"
+    "sigs.k8s.io/yaml"
+)
+
+const (
+    RuleModeEnforce = "enforce"
+    RuleModeAudit = "audit"
+)
+
+// RuleSet is a set of CEL expressions that are evaluated for every secret a pod requests. The expressions
+// can use the variables object (the pod), secret (the secret reference being checked), secrets (all the
+// secret references) and userInfo (the user making the request).
+type RuleSet struct {
+    Mode string `json:"mode,omitempty"`
+    Rules []Rule `json:"rules"`
+}
+
+// Rule is a CEL expression that must evaluate to true. In audit mode, failures produce a warning rather
+// than a denial. The mode defaults to that of the rule set.
+type Rule struct {
+    Name string `json:"name"`
+    Expression string `json:"expression"`
+    Message string `json:"message,omitempty"`
+    Mode string `json:"mode,omitempty"`
+    program cel.Program
+}
+
+// SecretReference is a secret requested by a pod, as exposed to the CEL expressions.
+type SecretReference struct {
+    Name string `json:"name"`
+    Arn string `json:"arn,omitempty"`
+    Region string `json:"region,omitempty"`
+}
+
+// RulesFile caches the rule set read from a file, re-reading and compiling it when the file changes.
+type RulesFile struct {
+    file WatchedFile
+    mutex sync.Mutex
+    ruleSet *RuleSet
+    err error
+}
+
+var (
+    rulesFile *RulesFile
+)
+
+// newRulesFile creates a RulesFile for the given path.
+func newRulesFile(path string) *RulesFile {
+    return &RulesFile{file: WatchedFile{path: path}}
+}
+
+// load returns the current rule set, re-reading the file if it has been modified.
+func (f *RulesFile) load() (*RuleSet, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    data, changed, err := f.file.readIfChanged()
+    if err != nil {
+        return nil, fmt.Errorf("Unable to read secret injection rules %s: %v", f.file.path, err)
+    }
+    if !changed {
+        return f.ruleSet, f.err
+    }
+    ruleSet, err := compileRuleSet(data)
+    if err != nil {
+        f.ruleSet, f.err = nil, fmt.Errorf("Unable to load secret injection rules %s: %v", f.file.path, err)
+        return f.ruleSet, f.err
+    }
+    klog.Info("Loaded secret injection rules from ", f.file.path, " with ", len(ruleSet.Rules), " rules")
+    f.ruleSet, f.err = ruleSet, nil
+    return f.ruleSet, f.err
+}
+
+// compileRuleSet parses a rule set and compiles its CEL expressions.
+func compileRuleSet(data []byte) (*RuleSet, error) {
+    ruleSet := RuleSet{}
+    if err := yaml.UnmarshalStrict(data, &ruleSet); err != nil {
+        return nil, err
+    }
+    if ruleSet.Mode == "" {
+        ruleSet.Mode = RuleModeEnforce
+    }
+    env, err := cel.NewEnv(cel.Declarations(
+        decls.NewVar("object", decls.Dyn),
+        decls.NewVar("secret", decls.Dyn),
+        decls.NewVar("secrets", decls.NewListType(decls.Dyn)),
+        decls.NewVar("userInfo", decls.Dyn),
+    ))
+    if err != nil {
+        return nil, err
+    }
+    for i := range ruleSet.Rules {
+        rule := &ruleSet.Rules[i]
+        if rule.Mode == "" {
+            rule.Mode = ruleSet.Mode
+        }
+        if rule.Mode != RuleModeEnforce && rule.Mode != RuleModeAudit {
+            return nil, fmt.Errorf("rule %s has invalid mode %q (expected %s or %s)", rule.Name, rule.Mode, RuleModeEnforce, RuleModeAudit)
+        }
+        ast, issues := env.Compile(rule.Expression)
+        if issues != nil && issues.Err() != nil {
+            return nil, fmt.Errorf("rule %s could not be compiled: %v", rule.Name, issues.Err())
+        }
+        rule.program, err = env.Program(ast)
+        if err != nil {
+            return nil, fmt.Errorf("rule %s could not be compiled: %v", rule.Name, err)
+        }
+    }
+    return &ruleSet, nil
+}
+
+// evaluateRules checks the secrets requested by a pod against the secret injection rules, if any are
+// configured. Failures of rules in audit mode are returned as warnings.
+func evaluateRules(pod core.Pod, secrets []SecretReference, userInfo authentication.UserInfo, log requestLogger) ([]string, error) {
+    if rulesFile == nil {
+        return nil, nil
+    }
+    ruleSet, err := rulesFile.load()
+    if err != nil {
+        log.error(err, "Unable to load secret injection rules")
+        return nil, internalError(deniedInternalError, fmt.Errorf("Secret injection rules could not be loaded, so no secrets can be injected"))
+    }
+    warnings, err := ruleSet.evaluate(pod, secrets, userInfo)
+    if err != nil {
+        return warnings, forbidden(deniedRule, err)
+    }
+    if len(warnings) > 0 {
+        log.info("Secret injection rules in audit mode failed, allowing the secrets", "failures", len(warnings))
+    } else {
+        log.info("Secret injection rules allow the secrets")
+    }
+    return warnings, nil
+}
+
+// evaluate runs each rule against each of the secrets.
+func (r *RuleSet) evaluate(pod core.Pod, secrets []SecretReference, userInfo authentication.UserInfo) ([]string, error) {
+    vars := map[string]interface{}{}
+    for name, value := range map[string]interface{}{"object": pod, "secrets": secrets, "userInfo": userInfo} {
+        converted, err := toUnstructured(value)
+        if err != nil {
+            return nil, err
+        }
+        vars[name] = converted
+    }
+    var warnings []string
+    for _, rule := range r.Rules {
+        for _, secret := range secrets {
+            converted, err := toUnstructured(secret)
+            if err != nil {
+                return nil, err
+            }
+            vars["secret"] = converted
+            failure := ""
+            result, _, err := rule.program.Eval(vars)
+            if err != nil {
+                failure = fmt.Sprintf("Secret injection rule %s could not be evaluated for secret %s: %v", rule.Name, secret.Name, err)
+            } else if allowed, ok := result.Value().(bool); !ok {
+                failure = fmt.Sprintf("Secret injection rule %s did not evaluate to a boolean for secret %s", rule.Name, secret.Name)
+            } else if !allowed {
+                failure = fmt.Sprintf("Secret injection rule %s failed for secret %s", rule.Name, secret.Name)
+                if rule.Message != "" {
+                    failure = fmt.Sprintf("%s: %s", failure, rule.Message)
+                }
+            }
+            if failure == "" {
+                continue
+            }
+            if rule.Mode == RuleModeAudit {
+                warnings = append(warnings, failure)
+            } else {
+                return warnings, fmt.Errorf("%s", failure)
+            }
+        }
+    }
+    return warnings, nil
+}
+
+// secretReferences builds the list of secrets requested by a pod from its annotations.
+func secretReferences(secretArns []string, secretNames []string, region string) []SecretReference {
+    var references []SecretReference
+    for _, secretArn := range secretArns {
+        reference := SecretReference{Name: secretArn, Arn: secretArn}
+        if parsed, err := parseArn(secretArn); err == nil {
+            reference.Region = parsed.Region
+            reference.Name = strings.TrimPrefix(parsed.Resource, "secret:")
+        }
+        references = append(references, reference)
+    }
+    for _, secretName := range secretNames {
+        references = append(references, SecretReference{Name: secretName, Region: region})
+    }
+    return references
+}
+
+// toUnstructured converts a value to the maps and lists that CEL expressions can work with, using its JSON
+// representation so that field names match the Kubernetes API.
+func toUnstructured(value interface{}) (interface{}, error) {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+    var converted interface{}
+    err = json.Unmarshal(data, &converted)
+    return converted, err
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "strings"
+    "testing"
+
+    authentication "k8s.io/api/authentication/v1"
+    core "k8s.io/api/core/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCompileRuleSetErrors(t *testing.T) {
+    tests := map[string]string{
+        "rules:\n- name: syntax\n  expression: \"secret.name.startsWith(\"\n": "rule syntax could not be compiled",
+        "rules:\n- name: unknown\n  expression: \"pod.metadata.name == 'app'\"\n": "rule unknown could not be compiled",
+        "rules:\n- name: mode\n  mode: warn\n  expression: \"true\"\n": `rule mode has invalid mode "warn"`,
+        "mode: dry-run\nrules:\n- name: inherited\n  expression: \"true\"\n": `rule inherited has invalid mode "dry-run"`,
+        "rules:\n- name: field\n  expresion: \"true\"\n": "unknown field",
+    }
+    for data, expected := range tests {
+        if _, err := compileRuleSet([]byte(data)); err == nil || !strings.Contains(err.Error(), expected) {
+            t.Errorf("expected an error containing %q for %q, got %v", expected, data, err)
+        }
+    }
+}
+
+func TestRuleSetEvaluate(t *testing.T) {
+    pod := core.Pod{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team-a"}}
+    secrets := []SecretReference{{Name: "team-a/db", Region: "us-east-1"}, {Name: "team-b/db", Region: "us-east-1"}}
+    userInfo := authentication.UserInfo{Username: "admin"}
+    tests := []struct {
+        name string
+        rules string
+        warnings int
+        err string
+    }{
+        {name: "allowed", rules: `rules:
+- name: prefix
+  expression: "secret.name.startsWith('team-')"
+`},
+        {name: "denied", rules: `rules:
+- name: namespace-prefix
+  expression: "secret.name.startsWith(object.metadata.namespace + '/')"
+  message: secret names must start with the namespace
+`, err: "Secret injection rule namespace-prefix failed for secret team-b/db: secret names must start with the namespace"},
+        {name: "audit", rules: `mode: audit
+rules:
+- name: namespace-prefix
+  expression: "secret.name.startsWith(object.metadata.namespace + '/')"
+`, warnings: 1},
+        {name: "audit rule in an enforced set", rules: `rules:
+- name: audited
+  mode: audit
+  expression: "secret.name == 'team-a/db'"
+- name: enforced
+  expression: "secret.name != 'team-b/db'"
+`, warnings: 1, err: "rule enforced failed for secret team-b/db"},
+        {name: "not a boolean", rules: `rules:
+- name: string
+  expression: "secret.name"
+`, err: "Secret injection rule string did not evaluate to a boolean for secret team-a/db"},
+        {name: "evaluation error", rules: `rules:
+- name: missing-field
+  expression: "object.metadata.labels.app == 'app'"
+`, err: "Secret injection rule missing-field could not be evaluated for secret team-a/db"},
+        {name: "user and all secrets", rules: `rules:
+- name: admin-only
+  expression: "userInfo.username == 'admin' && secrets.size() == 2"
+`},
+    }
+    for _, test := range tests {
+        ruleSet, err := compileRuleSet([]byte(test.rules))
+        if err != nil {
+            t.Errorf("%s: unexpected error compiling rules: %v", test.name, err)
+            continue
+        }
+        warnings, err := ruleSet.evaluate(pod, secrets, userInfo)
+        if len(warnings) != test.warnings {
+            t.Errorf("%s: expected %d warnings, got %q", test.name, test.warnings, warnings)
+        }
+        if test.err == "" && err != nil {
+            t.Errorf("%s: unexpected error: %v", test.name, err)
+        } else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+            t.Errorf("%s: expected an error containing %q, got %v", test.name, test.err, err)
+        }
+    }
+}
+
+func TestSecretReferences(t *testing.T) {
+    references := secretReferences([]string{"arn:aws:secretsmanager:eu-west-1:123456789012:secret:team-a/db-hlRvvF", "not-an-arn"}, []string{"team-a/api"}, "us-east-1")
+    expected := []SecretReference{
+        {Name: "team-a/db-hlRvvF", Arn: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:team-a/db-hlRvvF", Region: "eu-west-1"},
+        {Name: "not-an-arn", Arn: "not-an-arn"},
+        {Name: "team-a/api", Region: "us-east-1"},
+    }
+    if len(references) != len(expected) {
+        t.Fatalf("expected %+v, got %+v", expected, references)
+    }
+    for i := range expected {
+        if references[i] != expected[i] {
+            t.Errorf("expected %+v, got %+v", expected[i], references[i])
+        }
+    }
+}
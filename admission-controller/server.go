@@ -0,0 +1,198 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "os/signal"
+    "strings"
+    "sync/atomic"
+    "syscall"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "k8s.io/klog/v2"
+)
+
+var (
+    tlsVersions = map[string]uint16{
+        "1.2": tls.VersionTLS12,
+        "1.3": tls.VersionTLS13,
+    }
+    /* set once a shutdown signal has been received, so that the pod is no longer reported as ready */
+    shuttingDown int32
+)
+
+// newTLSConfig creates the TLS configuration of the webhook server from the command line settings.
+func newTLSConfig(minVersion string, cipherSuites string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, error) {
+    version, ok := tlsVersions[minVersion]
+    if !ok {
+        return nil, fmt.Errorf("Unsupported minimum TLS version %q (expected 1.2 or 1.3)", minVersion)
+    }
+    tlsConfig := &tls.Config{
+        MinVersion: version,
+        GetCertificate: getCertificate,
+    }
+    if cipherSuites == "" {
+        return tlsConfig, nil
+    }
+    ids := map[string]uint16{}
+    for _, suite := range tls.CipherSuites() {
+        ids[suite.Name] = suite.ID
+    }
+    for _, name := range splitList(cipherSuites) {
+        id, ok := ids[name]
+        if !ok {
+            return nil, fmt.Errorf("Unsupported or insecure TLS cipher suite %q (expected one of %s)", name, cipherSuiteNames())
+        }
+        tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+    }
+    return tlsConfig, nil
+}
+
+// requireClientCertificates makes the server reject clients that do not present a certificate issued by a CA in
+// caFile, e.g. the client certificate the API server is configured to use for webhooks. If allowedNames is not
+// empty, the certificate's common name or one of its DNS names must also be in the list.
+func requireClientCertificates(tlsConfig *tls.Config, caFile string, allowedNames []string) error {
+    data, err := ioutil.ReadFile(caFile)
+    if err != nil {
+        return fmt.Errorf("Unable to read client CA %s: %v", caFile, err)
+    }
+    clientCAs := x509.NewCertPool()
+    if !clientCAs.AppendCertsFromPEM(data) {
+        return fmt.Errorf("No certificates found in client CA %s", caFile)
+    }
+    tlsConfig.ClientCAs = clientCAs
+    tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+    if len(allowedNames) == 0 {
+        return nil
+    }
+    tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+        for _, chain := range verifiedChains {
+            if len(chain) > 0 && clientNameAllowed(chain[0], allowedNames) {
+                return nil
+            }
+        }
+        return fmt.Errorf("client certificate is not for one of the allowed names %s", strings.Join(allowedNames, ", "))
+    }
+    return nil
+}
+
+// clientNameAllowed checks whether the common name or one of the DNS names of a client certificate is allowed.
+func clientNameAllowed(cert *x509.Certificate, allowedNames []string) bool {
+    if containsString(allowedNames, cert.Subject.CommonName) {
+        return true
+    }
+    for _, name := range cert.DNSNames {
+        if containsString(allowedNames, name) {
+            return true
+        }
+    }
+    return false
+}
+
+// newServer creates an HTTP server with the timeouts from the command line settings.
+func newServer(address string, handler http.Handler) *http.Server {
+    return &http.Server{
+        Addr: address,
+        Handler: handler,
+        ReadHeaderTimeout: config.ReadHeaderTimeout,
+        ReadTimeout: config.ReadTimeout,
+        WriteTimeout: config.WriteTimeout,
+        IdleTimeout: config.IdleTimeout,
+    }
+}
+
+// addHealthHandlers adds the liveness, readiness and metrics endpoints.
+func addHealthHandlers(mux *http.ServeMux) {
+    mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+    mux.HandleFunc("/readyz", serveReady)
+    mux.Handle("/metrics", promhttp.Handler())
+}
+
+// serveReady reports whether the webhook can handle requests: it must have a certificate and not be shutting down.
+func serveReady(w http.ResponseWriter, r *http.Request) {
+    if atomic.LoadInt32(&shuttingDown) != 0 {
+        http.Error(w, "shutting down", http.StatusServiceUnavailable)
+        return
+    }
+    if certWatcher == nil {
+        http.Error(w, "no TLS certificate", http.StatusServiceUnavailable)
+        return
+    }
+    if _, err := certWatcher.load(); err != nil {
+        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+        return
+    }
+    w.Write([]byte("ok"))
+}
+
+// runServers serves the webhook (and the health endpoints, if they are on a separate server) until SIGTERM or
+// SIGINT is received. It then cancels the background work, reports the pod as not ready, waits for it to be
+// removed from the service's endpoints, and stops accepting connections while letting the requests in flight
+// complete.
+func runServers(webhookServer *http.Server, healthServer *http.Server, cancel context.CancelFunc) {
+    go func() {
+        klog.Info("Serving webhooks on ", webhookServer.Addr)
+        if err := webhookServer.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+            klog.Fatal(err)
+        }
+    }()
+    if healthServer != nil {
+        go func() {
+            klog.Info("Serving health checks and metrics on ", healthServer.Addr)
+            if err := healthServer.ListenAndServe(); err != http.ErrServerClosed {
+                klog.Fatal(err)
+            }
+        }()
+    }
+
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+    received := <-signals
+    klog.Info("Received ", received, ", shutting down in ", config.ShutdownDelay)
+    atomic.StoreInt32(&shuttingDown, 1)
+    cancel()
+    time.Sleep(config.ShutdownDelay)
+
+    ctx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+    defer cancelShutdown()
+    if err := webhookServer.Shutdown(ctx); err != nil {
+        klog.Error("Webhook requests did not complete before the shutdown timeout: ", err)
+    }
+    if healthServer != nil {
+        if err := healthServer.Shutdown(ctx); err != nil {
+            klog.Error(err)
+        }
+    }
+    klog.Info("Shut down")
+}
+
+// cipherSuiteNames lists the cipher suites that can be used with --tls-cipher-suites.
+func cipherSuiteNames() string {
+    var names []string
+    for _, suite := range tls.CipherSuites() {
+        names = append(names, suite.Name)
+    }
+    return strings.Join(names, ", ")
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "crypto/ecdsa"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// testCA is a locally generated CA for issuing test certificates.
+type testCA struct {
+    cert *x509.Certificate
+    key *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+    t.Helper()
+    cert, key, err := generateCA(time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+    return testCA{cert: cert, key: key}
+}
+
+// writeTo writes the CA certificate to a file in dir, for use with --client-ca-file.
+func (ca testCA) writeTo(t *testing.T, dir string) string {
+    t.Helper()
+    path := filepath.Join(dir, "client-ca.crt")
+    if err := ioutil.WriteFile(path, encodeCertificates([]*x509.Certificate{ca.cert}), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// clientCertificate issues a client certificate, like the one the API server presents to webhooks.
+func (ca testCA) clientCertificate(t *testing.T, commonName string) tls.Certificate {
+    t.Helper()
+    template := x509.Certificate{
+        Subject: pkix.Name{CommonName: commonName},
+        NotBefore: time.Now().Add(-time.Hour),
+        NotAfter: time.Now().Add(time.Hour),
+        KeyUsage: x509.KeyUsageDigitalSignature,
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+    }
+    cert, key, err := generateCertificate(&template, ca.cert, ca.key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+// newMutualTLSServer starts a webhook server that requires client certificates from the client CA.
+func newMutualTLSServer(t *testing.T, serverCA testCA, clientCAFile string, allowedNames []string) *httptest.Server {
+    t.Helper()
+    servingCert, servingKey, err := generateServingCert(serverCA.cert, serverCA.key, []string{"localhost"}, time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+    certificate := tls.Certificate{Certificate: [][]byte{servingCert.Raw}, PrivateKey: servingKey}
+    tlsConfig, err := newTLSConfig("1.2", "", func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &certificate, nil })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := requireClientCertificates(tlsConfig, clientCAFile, allowedNames); err != nil {
+        t.Fatal(err)
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("/mutating-pods", serveMutatePods)
+    server := httptest.NewUnstartedServer(mux)
+    server.TLS = tlsConfig
+    server.StartTLS()
+    t.Cleanup(server.Close)
+    return server
+}
+
+// postWithClientCertificate sends the example request, presenting the given client certificates.
+func postWithClientCertificate(t *testing.T, server *httptest.Server, serverCA testCA, certificates []tls.Certificate) (*http.Response, error) {
+    t.Helper()
+    roots := x509.NewCertPool()
+    roots.AddCert(serverCA.cert)
+    client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+        RootCAs: roots,
+        ServerName: "localhost",
+        Certificates: certificates,
+    }}}
+    response, err := client.Post(server.URL+"/mutating-pods", "application/json", bytes.NewReader(readExampleRequest(t, "example-request.json")))
+    if err == nil {
+        response.Body.Close()
+    }
+    return response, err
+}
+
+func TestMutualTLS(t *testing.T) {
+    dir, err := ioutil.TempDir("", "mtls")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    serverCA := newTestCA(t)
+    clientCA := newTestCA(t)
+    otherCA := newTestCA(t)
+    clientCAFile := clientCA.writeTo(t, dir)
+
+    tests := []struct {
+        name string
+        allowedNames []string
+        certificates []tls.Certificate
+        allowed bool
+    }{
+        {name: "client certificate from the client CA", certificates: []tls.Certificate{clientCA.clientCertificate(t, "kube-apiserver")}, allowed: true},
+        {name: "no client certificate", allowed: false},
+        {name: "client certificate from another CA", certificates: []tls.Certificate{otherCA.clientCertificate(t, "kube-apiserver")}, allowed: false},
+        {name: "allowed name", allowedNames: []string{"kube-apiserver"}, certificates: []tls.Certificate{clientCA.clientCertificate(t, "kube-apiserver")}, allowed: true},
+        {name: "name not allowed", allowedNames: []string{"kube-apiserver"}, certificates: []tls.Certificate{clientCA.clientCertificate(t, "tenant-pod")}, allowed: false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            server := newMutualTLSServer(t, serverCA, clientCAFile, test.allowedNames)
+            response, err := postWithClientCertificate(t, server, serverCA, test.certificates)
+            if test.allowed {
+                if err != nil {
+                    t.Fatalf("expected request to be accepted, got %v", err)
+                }
+                if response.StatusCode != http.StatusOK {
+                    t.Errorf("expected HTTP status %d, got %d", http.StatusOK, response.StatusCode)
+                }
+            } else if err == nil {
+                t.Errorf("expected the TLS handshake to fail, got HTTP status %d", response.StatusCode)
+            }
+        })
+    }
+}
+
+func TestRequireClientCertificatesInvalidCA(t *testing.T) {
+    dir, err := ioutil.TempDir("", "mtls")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "client-ca.crt")
+    if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not a certificate")}), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := requireClientCertificates(&tls.Config{}, path, nil); err == nil {
+        t.Error("expected an error for a client CA file without certificates")
+    }
+    if err := requireClientCertificates(&tls.Config{}, filepath.Join(dir, "missing.crt"), nil); err == nil {
+        t.Error("expected an error for a missing client CA file")
+    }
+}
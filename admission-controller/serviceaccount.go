@@ -0,0 +1,111 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    core "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+    irsaRoleArnAnnotation = "eks.amazonaws.com/role-arn"
+    irsaTokenVolumeName = "aws-iam-token"
+    irsaTokenMountPath = "/var/run/secrets/eks.amazonaws.com/serviceaccount"
+    irsaTokenAudience = "sts.amazonaws.com"
+    irsaTokenExpirationSeconds int64 = 86400
+)
+
+var (
+    clientset kubernetes.Interface
+    // offline is set by the render and lint commands, which have no cluster to look things up in: namespaces
+    // and service accounts are assumed to exist, without annotations.
+    offline bool
+)
+
+// newClientset creates a Kubernetes client from the given kubeconfig file, or from the in-cluster
+// configuration if no file is given.
+func newClientset(kubeconfig string) (kubernetes.Interface, error) {
+    var restConfig *rest.Config
+    var err error
+    if kubeconfig != "" {
+        restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+    } else {
+        restConfig, err = rest.InClusterConfig()
+    }
+    if err != nil {
+        return nil, err
+    }
+    return kubernetes.NewForConfig(restConfig)
+}
+
+// getServiceAccountRoleArn looks up the IRSA role ARN annotation on the pod's service account. An empty string
+// is returned if the service account is not annotated. If the service account cannot be looked up, the pod is
+// denied rather than silently left with the node's credentials.
+func getServiceAccountRoleArn(namespace string, serviceAccountName string, log requestLogger) (string, error) {
+    if serviceAccountName == "" {
+        serviceAccountName = "default"
+    }
+    if offline {
+        log.info("Not looking up the service account without a cluster", "serviceAccount", namespace+"/"+serviceAccountName)
+        return "", nil
+    }
+    if clientset == nil {
+        return "", internalError(deniedLookupFailed, fmt.Errorf("No Kubernetes client available - unable to look up service account %s/%s", namespace, serviceAccountName))
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    serviceAccount, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccountName, meta.GetOptions{})
+    if errors.IsNotFound(err) {
+        return "", badRequest(deniedCredentials, fmt.Errorf("Service account %s/%s not found - unable to determine which credentials the init container should use", namespace, serviceAccountName))
+    }
+    if err != nil {
+        return "", internalError(deniedLookupFailed, fmt.Errorf("Unable to look up service account %s/%s: %v", namespace, serviceAccountName, err))
+    }
+    roleArn := serviceAccount.ObjectMeta.Annotations[irsaRoleArnAnnotation]
+    log.info("Looked up service account", "serviceAccount", namespace+"/"+serviceAccountName, "roleArn", roleArn)
+    return roleArn, nil
+}
+
+// irsaTokenVolume returns a projected service account token volume equivalent to the one added by
+// the EKS pod identity webhook.
+func irsaTokenVolume() core.Volume {
+    expirationSeconds := irsaTokenExpirationSeconds
+    return core.Volume{
+        Name: irsaTokenVolumeName,
+        VolumeSource: core.VolumeSource{
+            Projected: &core.ProjectedVolumeSource{
+                Sources: []core.VolumeProjection{
+                    core.VolumeProjection{
+                        ServiceAccountToken: &core.ServiceAccountTokenProjection{
+                            Audience: irsaTokenAudience,
+                            ExpirationSeconds: &expirationSeconds,
+                            Path: "token",
+                        },
+                    },
+                },
+            },
+        },
+    }
+}
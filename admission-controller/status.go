@@ -0,0 +1,147 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "strings"
+
+    core "k8s.io/api/core/v1"
+)
+
+// Status annotations are added to a pod when secrets are injected, recording what was done so that later
+// admissions (e.g. when the webhook is reinvoked) and troubleshooting tools can tell.
+const (
+    injectedAnnotation = "secrets.aws.k8s/injected"
+    injectorVersionAnnotation = "secrets.aws.k8s/injectorVersion"
+    injectionModeAnnotation = "secrets.aws.k8s/injectionMode"
+    secretSpecHashAnnotation = "secrets.aws.k8s/secretSpecHash"
+    initContainerImageAnnotation = "secrets.aws.k8s/initContainerImage"
+    initContainerImageDigestAnnotation = "secrets.aws.k8s/initContainerImageDigest"
+)
+
+// statusAnnotationNames are the status annotations, which are not reported as unknown annotations.
+var statusAnnotationNames = []string{
+    injectedAnnotation,
+    injectorVersionAnnotation,
+    injectionModeAnnotation,
+    secretSpecHashAnnotation,
+    initContainerImageAnnotation,
+    initContainerImageDigestAnnotation,
+}
+
+// version is the version of the admission controller, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// secretSpec is everything that determines which secrets the init container fetches and how. Its hash changes
+// whenever the injected init container would behave differently.
+type secretSpec struct {
+    Mode string `json:"mode"`
+    SecretArns []string `json:"secretArns,omitempty"`
+    SecretNames []string `json:"secretNames,omitempty"`
+    Region string `json:"region,omitempty"`
+    ExplodeJsonKeys *bool `json:"explodeJsonKeys,omitempty"`
+    RoleArn string `json:"roleArn,omitempty"`
+    ExternalId string `json:"externalId,omitempty"`
+    SecretRoles map[string]SecretRole `json:"secretRoles,omitempty"`
+    CredentialMechanism CredentialMechanism `json:"credentialMechanism"`
+}
+
+// secretSpecHash hashes the secret spec of a pod, as "sha256:" followed by the hex encoded hash.
+func secretSpecHash(secretAnnotations *SecretAnnotations, region string, mechanism CredentialMechanism) string {
+    spec := secretSpec{
+        Mode: secretAnnotations.InjectorWebhook,
+        SecretArns: secretAnnotations.SecretArns,
+        SecretNames: secretAnnotations.SecretNames,
+        Region: region,
+        ExplodeJsonKeys: secretAnnotations.ExplodeJsonKeys,
+        RoleArn: secretAnnotations.RoleArn,
+        ExternalId: secretAnnotations.ExternalId,
+        SecretRoles: secretAnnotations.SecretRoles,
+        CredentialMechanism: mechanism,
+    }
+    data, _ := json.Marshal(spec) /* cannot fail: the spec only has strings, lists and maps */
+    hash := sha256.Sum256(data)
+    return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// imageDigest returns the digest of an image reference that is pinned by digest (e.g. repo@sha256:...), or an
+// empty string if it is only referenced by tag. The registry is not asked what a tag points to, so pods
+// injected with a tag-based image have no digest annotation.
+func imageDigest(image string) string {
+    if i := strings.LastIndex(image, "@"); i >= 0 {
+        return image[i+1:]
+    }
+    return ""
+}
+
+// statusAnnotations records how secrets were injected into a pod.
+func statusAnnotations(mode string, specHash string, image string) map[string]string {
+    annotations := map[string]string{
+        injectedAnnotation: "true",
+        injectorVersionAnnotation: version,
+        injectionModeAnnotation: mode,
+        secretSpecHashAnnotation: specHash,
+        initContainerImageAnnotation: image,
+    }
+    if digest := imageDigest(image); digest != "" {
+        annotations[initContainerImageDigestAnnotation] = digest
+    }
+    return annotations
+}
+
+// statusPatches adds the status annotations to a pod, replacing any that are already set and removing any that
+// no longer apply (e.g. if the pod was copied from one that had them).
+func statusPatches(pod core.Pod, annotations map[string]string) []Patch {
+    var patches []Patch
+    if pod.ObjectMeta.Annotations == nil {
+        patches = append(patches, Patch{
+            Op: "add",
+            Path: "/metadata/annotations",
+            Value: map[string]string{},
+        })
+    }
+    for _, key := range statusAnnotationNames {
+        if _, stale := pod.ObjectMeta.Annotations[key]; stale && annotations[key] == "" {
+            patches = append(patches, Patch{
+                Op: "remove",
+                Path: "/metadata/annotations/" + escapeJSONPointer(key),
+            })
+        }
+    }
+    for _, key := range sortedKeys(annotations) {
+        patches = append(patches, Patch{
+            Op: "add",
+            Path: "/metadata/annotations/" + escapeJSONPointer(key),
+            Value: annotations[key],
+        })
+    }
+    return patches
+}
+
+// alreadyInjected checks whether secrets have already been injected into a pod, e.g. because the webhook is
+// being reinvoked after another webhook changed the pod.
+func alreadyInjected(pod core.Pod) bool {
+    return pod.ObjectMeta.Annotations[injectedAnnotation] == "true" && hasContainer(pod.Spec.InitContainers, "secrets-init-container")
+}
+
+// escapeJSONPointer escapes a key for use in a JSON patch path.
+func escapeJSONPointer(key string) string {
+    return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
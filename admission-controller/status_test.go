@@ -0,0 +1,131 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+// annotationPatches returns the values of the annotations set by a JSON patch.
+func annotationPatches(t *testing.T, patch []byte) map[string]interface{} {
+    t.Helper()
+    var patches []Patch
+    if err := json.Unmarshal(patch, &patches); err != nil {
+        t.Fatal(err)
+    }
+    annotations := map[string]interface{}{}
+    for _, p := range patches {
+        const prefix = "/metadata/annotations/secrets.aws.k8s~1"
+        if p.Op == "add" && len(p.Path) > len(prefix) && p.Path[:len(prefix)] == prefix {
+            annotations["secrets.aws.k8s/"+p.Path[len(prefix):]] = p.Value
+        }
+    }
+    return annotations
+}
+
+// exampleRequestWithPod changes the pod in the example request.
+func exampleRequestWithPod(t *testing.T, change func(pod map[string]interface{})) []byte {
+    t.Helper()
+    review := map[string]interface{}{}
+    if err := json.Unmarshal(readExampleRequest(t, "example-request.json"), &review); err != nil {
+        t.Fatal(err)
+    }
+    change(review["request"].(map[string]interface{})["object"].(map[string]interface{}))
+    body, err := json.Marshal(review)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return body
+}
+
+func TestStatusAnnotations(t *testing.T) {
+    withCluster(t)
+    image := config.InitContainerImage
+    config.InitContainerImage = "ghcr.io/ecrousseau/aws-secret-injector/init-container@sha256:0123abcd"
+    defer func() { config.InitContainerImage = image }()
+
+    response := decodeAdmissionResponse(t, postMutatePods(readExampleRequest(t, "example-request.json")))
+    annotations := annotationPatches(t, response.Patch)
+    expected := map[string]interface{}{
+        injectedAnnotation: "true",
+        injectorVersionAnnotation: version,
+        injectionModeAnnotation: "init-container",
+        initContainerImageAnnotation: config.InitContainerImage,
+        initContainerImageDigestAnnotation: "sha256:0123abcd",
+    }
+    for key, value := range expected {
+        if annotations[key] != value {
+            t.Errorf("expected annotation %s to be %q, got %q", key, value, annotations[key])
+        }
+    }
+    if hash, _ := annotations[secretSpecHashAnnotation].(string); len(hash) != len("sha256:")+64 {
+        t.Errorf("expected a sha256 secret spec hash, got %q", hash)
+    }
+}
+
+func TestImageDigest(t *testing.T) {
+    tests := map[string]string{
+        "ghcr.io/ecrousseau/aws-secret-injector/init-container@sha256:0123abcd": "sha256:0123abcd",
+        "ghcr.io/ecrousseau/aws-secret-injector/init-container:v1.5@sha256:0123abcd": "sha256:0123abcd",
+        "ghcr.io/ecrousseau/aws-secret-injector/init-container:v1.5": "",
+        "localhost:5000/init-container": "",
+    }
+    for image, expected := range tests {
+        if digest := imageDigest(image); digest != expected {
+            t.Errorf("%s: expected digest %q, got %q", image, expected, digest)
+        }
+        if _, ok := statusAnnotations("init-container", "sha256:hash", image)[initContainerImageDigestAnnotation]; ok != (expected != "") {
+            t.Errorf("%s: expected the digest annotation to be set only for a digest-pinned image", image)
+        }
+    }
+}
+
+func TestAlreadyInjected(t *testing.T) {
+    body := exampleRequestWithPod(t, func(pod map[string]interface{}) {
+        pod["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})[injectedAnnotation] = "true"
+        spec := pod["spec"].(map[string]interface{})
+        spec["initContainers"] = []interface{}{map[string]interface{}{"name": "secrets-init-container", "image": "init"}}
+    })
+    response := decodeAdmissionResponse(t, postMutatePods(body))
+    if !response.Allowed || len(response.Patch) != 0 {
+        t.Errorf("expected a pod with secrets already injected to be allowed unchanged, got %v %s", response.Result, response.Patch)
+    }
+
+    body = exampleRequestWithPod(t, func(pod map[string]interface{}) {
+        spec := pod["spec"].(map[string]interface{})
+        spec["initContainers"] = []interface{}{map[string]interface{}{"name": "secrets-init-container", "image": "init"}}
+    })
+    response = decodeAdmissionResponse(t, postMutatePods(body))
+    if response.Allowed {
+        t.Error("expected a pod with an init container named secrets-init-container but no status annotations to be denied")
+    }
+}
+
+func TestSecretSpecHash(t *testing.T) {
+    secretAnnotations := &SecretAnnotations{InjectorWebhook: "init-container", SecretNames: []string{"db", "api"}}
+    hash := secretSpecHash(secretAnnotations, "us-east-1", "irsa")
+    if secretSpecHash(secretAnnotations, "us-east-1", "irsa") != hash {
+        t.Error("expected the same spec to have the same hash")
+    }
+    if secretSpecHash(secretAnnotations, "eu-west-1", "irsa") == hash {
+        t.Error("expected a different region to change the hash")
+    }
+    if secretSpecHash(secretAnnotations, "us-east-1", "pod-identity") == hash {
+        t.Error("expected a different credential mechanism to change the hash")
+    }
+}
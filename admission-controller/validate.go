@@ -0,0 +1,144 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+
+    admission "k8s.io/api/admission/v1"
+    core "k8s.io/api/core/v1"
+)
+
+// podTemplatePaths gives the location of the pod template in each kind of workload.
+var podTemplatePaths = map[string][]string{
+    "Deployment": []string{"spec", "template"},
+    "StatefulSet": []string{"spec", "template"},
+    "DaemonSet": []string{"spec", "template"},
+    "ReplicaSet": []string{"spec", "template"},
+    "Job": []string{"spec", "template"},
+    "CronJob": []string{"spec", "jobTemplate", "spec", "template"},
+}
+
+// getPodTemplate extracts the pod template from a workload. The workload is handled as unstructured JSON,
+// so that any API version of the workload kinds (e.g. batch/v1 and batch/v1beta1 CronJobs) can be used.
+func getPodTemplate(kind string, raw []byte) (*core.PodTemplateSpec, error) {
+    path, ok := podTemplatePaths[kind]
+    if !ok {
+        return nil, fmt.Errorf("Unsupported kind %s", kind)
+    }
+    var object interface{}
+    if err := json.Unmarshal(raw, &object); err != nil {
+        return nil, err
+    }
+    for _, field := range path {
+        fields, ok := object.(map[string]interface{})
+        if !ok {
+            return nil, fmt.Errorf("%s has no pod template", kind)
+        }
+        object = fields[field]
+    }
+    if object == nil {
+        return nil, fmt.Errorf("%s has no pod template", kind)
+    }
+    data, err := json.Marshal(object)
+    if err != nil {
+        return nil, err
+    }
+    template := core.PodTemplateSpec{}
+    if err := json.Unmarshal(data, &template); err != nil {
+        return nil, err
+    }
+    return &template, nil
+}
+
+// validateWorkloads checks the secret injection annotations in the pod template of a workload, so that
+// mistakes are reported when the workload is applied rather than when its pods are created.
+func validateWorkloads(ar admission.AdmissionReview) (response *admission.AdmissionResponse) {
+    log := newRequestLogger(ar.Request).withValues("kind", ar.Request.Kind.Kind, "name", ar.Request.Name)
+    log.info("Validating workload")
+    reason := ""
+    audit := newAuditEvent("validate", ar.Request)
+    defer func() {
+        recordAdmission("validate", response, reason)
+        audit.complete(response, reason)
+        auditSink.record(audit)
+    }()
+    /* prepare the response */
+    reviewResponse := admission.AdmissionResponse{
+        Allowed: true,
+        UID: ar.Request.UID,
+    }
+    deny := func(err error) *admission.AdmissionResponse {
+        reason = denialCause(err)
+        return toV1AdmissionResponse(err, ar)
+    }
+
+    /* find the pod template */
+    kind := ar.Request.Kind.Kind
+    if _, ok := podTemplatePaths[kind]; !ok {
+        log.error(nil, "Unexpected kind", "gvk", ar.Request.Kind)
+        reason = skippedUnexpectedResource
+        return &reviewResponse  //something is wonky on the Kubernetes side - just send back an "Allow"
+    }
+    template, err := getPodTemplate(kind, ar.Request.Object.Raw)
+    if err != nil {
+        log.error(err, "Unable to decode pod template")
+        return deny(badRequest(deniedInvalidObject, err))
+    }
+
+    /* check the annotations in the same way as when the pods are created */
+    secretAnnotations, err := parseSecretAnnotations(template.ObjectMeta.Annotations)
+    if err != nil {
+        log.error(err, "Invalid secret injection annotations")
+        return deny(badRequest(deniedInvalidAnnotations, fmt.Errorf("%s %s: %v", kind, ar.Request.Name, err)))
+    }
+    audit.ServiceAccount = template.Spec.ServiceAccountName
+    audit.setSecrets(secretAnnotations)
+    reviewResponse.Warnings = append(reviewResponse.Warnings, secretAnnotations.Warnings...)
+    if secretAnnotations.InjectorWebhook == "" {
+        reason = skippedNotAnnotated
+        return &reviewResponse
+    }
+    if secretAnnotations.InjectorWebhook != "init-container" {
+        reason = skippedUnsupportedInjector
+        return &reviewResponse
+    }
+    region, regionWarnings, err := resolveRegion(secretAnnotations, ar.Request.Namespace, log)
+    if err != nil {
+        log.error(err, "Unable to resolve region")
+        return deny(err)
+    }
+    for _, warning := range regionWarnings {
+        log.warning(warning)
+    }
+    reviewResponse.Warnings = append(reviewResponse.Warnings, regionWarnings...)
+    audit.Region = region
+    pod := core.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+    pod.ObjectMeta.Namespace = ar.Request.Namespace
+    var accessWarnings []string
+    audit.PolicyDecision, accessWarnings, err = checkSecretAccess(pod, secretAnnotations, region, ar.Request.UserInfo, log)
+    for _, warning := range accessWarnings {
+        log.warning(warning)
+    }
+    reviewResponse.Warnings = append(reviewResponse.Warnings, accessWarnings...)
+    if err != nil {
+        log.error(err, "Secret access denied")
+        return deny(fmt.Errorf("%s %s: %w", kind, ar.Request.Name, err))
+    }
+    return &reviewResponse
+}
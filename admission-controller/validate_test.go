@@ -0,0 +1,182 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    admission "k8s.io/api/admission/v1"
+    meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+const validateTemplate = `{"metadata": {"annotations": {"secrets.aws.k8s/injectorWebhook": "init-container",
+    "secrets.aws.k8s/secretNames": "team-a/db"}}, "spec": {"containers": [{"name": "app", "image": "app:1"}]}}`
+
+// workload wraps a pod template in a workload of the given kind.
+func workload(kind string, template string) string {
+    spec := `{"selector": {"matchLabels": {"app": "app"}}, "template": ` + template + `}`
+    apiVersion := "apps/v1"
+    switch kind {
+    case "Job":
+        apiVersion, spec = "batch/v1", `{"template": `+template+`}`
+    case "CronJob":
+        apiVersion, spec = "batch/v1", `{"schedule": "@daily", "jobTemplate": {"spec": {"template": `+template+`}}}`
+    }
+    return `{"apiVersion": "` + apiVersion + `", "kind": "` + kind + `", "metadata": {"name": "app", "namespace": "my-namespace"}, "spec": ` + spec + `}`
+}
+
+// postValidate sends a workload to the validating webhook.
+func postValidate(t *testing.T, kind string, object string) *admission.AdmissionResponse {
+    t.Helper()
+    review := admission.AdmissionReview{
+        TypeMeta: meta.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+        Request: &admission.AdmissionRequest{
+            UID: "705ab4f5-6393-11e8-b7cc-42010a800002",
+            Kind: meta.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind},
+            Name: "app",
+            Namespace: "my-namespace",
+            Operation: admission.Create,
+            Object: runtime.RawExtension{Raw: []byte(object)},
+        },
+    }
+    body, err := json.Marshal(review)
+    if err != nil {
+        t.Fatal(err)
+    }
+    request := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    recorder := httptest.NewRecorder()
+    serveValidate(recorder, request)
+    return decodeAdmissionResponse(t, recorder)
+}
+
+// withPolicy uses a secret access policy while a test runs.
+func withPolicy(t *testing.T, policy string) {
+    t.Helper()
+    dir, err := ioutil.TempDir("", "validate")
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "policy.yaml")
+    if err := ioutil.WriteFile(path, []byte(policy), 0600); err != nil {
+        t.Fatal(err)
+    }
+    policyFile = newPolicyFile(path)
+    t.Cleanup(func() {
+        policyFile = nil
+        os.RemoveAll(dir)
+    })
+}
+
+func TestValidateWorkloads(t *testing.T) {
+    withCluster(t)
+    region := config.DefaultRegion
+    config.DefaultRegion = "us-east-1"
+    defer func() { config.DefaultRegion = region }()
+
+    invalidTemplate := strings.Replace(validateTemplate, `secretNames": "team-a/db"`, `secretArns": "db"`, 1)
+    tests := []struct {
+        name string
+        kind string
+        object string
+        allowed bool
+        code int32
+        message string
+    }{
+        {name: "Deployment", kind: "Deployment", object: workload("Deployment", validateTemplate), allowed: true},
+        {name: "StatefulSet", kind: "StatefulSet", object: workload("StatefulSet", validateTemplate), allowed: true},
+        {name: "DaemonSet", kind: "DaemonSet", object: workload("DaemonSet", validateTemplate), allowed: true},
+        {name: "Job", kind: "Job", object: workload("Job", validateTemplate), allowed: true},
+        {name: "CronJob", kind: "CronJob", object: workload("CronJob", validateTemplate), allowed: true},
+        {name: "not annotated", kind: "Deployment", object: workload("Deployment", `{"spec": {"containers": [{"name": "app", "image": "app:1"}]}}`), allowed: true},
+        {name: "unexpected kind", kind: "ConfigMap", object: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "app"}}`, allowed: true},
+        {name: "invalid annotations", kind: "Deployment", object: workload("Deployment", invalidTemplate),
+            code: http.StatusBadRequest, message: `Deployment app: Pod annotation secrets.aws.k8s/secretArns is invalid: "db" is not an ARN`},
+        {name: "invalid CronJob annotations", kind: "CronJob", object: workload("CronJob", invalidTemplate),
+            code: http.StatusBadRequest, message: "CronJob app: Pod annotation secrets.aws.k8s/secretArns is invalid"},
+        {name: "malformed object", kind: "Deployment", object: `{"kind": "Deployment", "spec": {"template": "app"}}`,
+            code: http.StatusBadRequest},
+        {name: "no pod template", kind: "CronJob", object: `{"kind": "CronJob", "spec": {"schedule": "@daily"}}`,
+            code: http.StatusBadRequest, message: "CronJob has no pod template"},
+    }
+    for _, test := range tests {
+        response := postValidate(t, test.kind, test.object)
+        if response.Allowed != test.allowed {
+            t.Errorf("%s: expected allowed to be %v, got %v", test.name, test.allowed, response.Result)
+            continue
+        }
+        if test.allowed {
+            continue
+        }
+        if response.Result == nil || response.Result.Code != test.code || !strings.Contains(response.Result.Message, test.message) {
+            t.Errorf("%s: expected code %d and a message containing %q, got %v", test.name, test.code, test.message, response.Result)
+        }
+    }
+}
+
+func TestValidateWorkloadsPolicy(t *testing.T) {
+    withCluster(t)
+    withPolicy(t, "rules:\n- name: my-namespace\n  namespaces: [my-namespace]\n  secretNames: [my-namespace/*]\n")
+    region := config.DefaultRegion
+    config.DefaultRegion = "us-east-1"
+    defer func() { config.DefaultRegion = region }()
+
+    response := postValidate(t, "StatefulSet", workload("StatefulSet", validateTemplate))
+    if response.Allowed || response.Result == nil || response.Result.Code != http.StatusForbidden {
+        t.Fatalf("expected the policy to deny the StatefulSet, got %v", response.Result)
+    }
+    expected := "StatefulSet app: Secret access policy does not allow service account default in namespace my-namespace to use secret name team-a/db (rules checked: my-namespace)"
+    if response.Result.Message != expected {
+        t.Errorf("expected message %q, got %q", expected, response.Result.Message)
+    }
+
+    allowed := strings.Replace(validateTemplate, "team-a/db", "my-namespace/db", 1)
+    if response := postValidate(t, "StatefulSet", workload("StatefulSet", allowed)); !response.Allowed {
+        t.Errorf("expected the policy to allow the StatefulSet, got %v", response.Result)
+    }
+}
+
+func TestValidateWorkloadsRules(t *testing.T) {
+    withCluster(t)
+    dir, err := ioutil.TempDir("", "validate")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "rules.yaml")
+    rules := "rules:\n- name: namespace-prefix\n  expression: \"secret.name.startsWith(object.metadata.namespace + '/')\"\n  message: secret names must start with the namespace\n"
+    if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+        t.Fatal(err)
+    }
+    rulesFile = newRulesFile(path)
+    defer func() { rulesFile = nil }()
+
+    response := postValidate(t, "Job", workload("Job", strings.Replace(validateTemplate, `secretNames": "team-a/db"`, `secretNames": "team-a/db", "secrets.aws.k8s/region": "us-east-1"`, 1)))
+    expected := "Job app: Secret injection rule namespace-prefix failed for secret team-a/db: secret names must start with the namespace"
+    if response.Allowed || response.Result == nil || response.Result.Message != expected {
+        t.Errorf("expected the rule to deny the Job with %q, got %v", expected, response.Result)
+    }
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2026 The aws-secret-injector Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/go-logr/logr"
+    "k8s.io/klog/v2"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+    /* values that look like credentials, wherever they appear in a log message */
+    credentialPatterns = []*regexp.Regexp{
+        regexp.MustCompile(`\b(AKIA|ASIA)[A-Z0-9]{16}\b`),
+        regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+        regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9+/=_.~-]{8,}`),
+        regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`),
+    }
+    /* credentials that are assigned to a key, e.g. password=... or "aws_secret_access_key": "..." - the key is kept */
+    credentialAssignment = regexp.MustCompile(`(?i)((?:secret_?access_?key|session_?token|password|passwd|api_?key|token)["']?\s*[:=]\s*["']?)([^\s"',}]+)`)
+)
+
+// setupLogging switches klog to the format in LOG_FORMAT (text, the default, or json), which is set by the
+// admission controller to its own format, and redacts anything that looks like a credential.
+func setupLogging(format string) error {
+    switch format {
+    case "", "text":
+    case "json":
+        klog.SetLogger(newJSONLogger(os.Stderr))
+    default:
+        return fmt.Errorf("Unsupported log format %q (expected text or json)", format)
+    }
+    klog.SetLogFilter(redactingFilter{})
+    return nil
+}
+
+// redactedError redacts credentials from the message of an error in a log message.
+type redactedError struct {
+    error
+}
+
+func (e redactedError) Error() string {
+    return redactString(e.error.Error())
+}
+
+// redactingFilter is a klog.LogFilter that removes anything that looks like a credential from log messages.
+type redactingFilter struct{}
+
+func (redactingFilter) Filter(args []interface{}) []interface{} {
+    filtered := make([]interface{}, len(args))
+    for i, arg := range args {
+        filtered[i] = redactValue(arg)
+    }
+    return filtered
+}
+
+func (f redactingFilter) FilterF(format string, args []interface{}) (string, []interface{}) {
+    return format, f.Filter(args)
+}
+
+func (f redactingFilter) FilterS(msg string, keysAndValues []interface{}) (string, []interface{}) {
+    return redactString(msg), f.Filter(keysAndValues)
+}
+
+func redactValue(value interface{}) interface{} {
+    switch v := value.(type) {
+    case string:
+        return redactString(v)
+    case []byte:
+        return redactString(string(v))
+    case error:
+        return redactedError{v}
+    }
+    return value
+}
+
+// redactString replaces anything that looks like a credential.
+func redactString(value string) string {
+    for _, pattern := range credentialPatterns {
+        value = pattern.ReplaceAllString(value, redacted)
+    }
+    return credentialAssignment.ReplaceAllString(value, "${1}"+redacted)
+}
+
+// jsonLogger is a logr.Logger that klog sends its messages to when LOG_FORMAT=json, writing one JSON object per
+// line with the time, level and message. The init container only logs plain messages, so unlike the admission
+// controller's logger it has no structured fields.
+type jsonLogger struct {
+    out io.Writer
+}
+
+type jsonLine struct {
+    Time string `json:"ts"`
+    Level string `json:"level"`
+    Message string `json:"msg"`
+    Error string `json:"err,omitempty"`
+}
+
+func newJSONLogger(out io.Writer) logr.Logger {
+    return jsonLogger{out: out}
+}
+
+func (l jsonLogger) Enabled() bool {
+    return true
+}
+
+func (l jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+    l.write("info", nil, msg)
+}
+
+func (l jsonLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+    l.write("error", err, msg)
+}
+
+func (l jsonLogger) V(level int) logr.Logger {
+    return l
+}
+
+func (l jsonLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+    return l
+}
+
+func (l jsonLogger) WithName(name string) logr.Logger {
+    return l
+}
+
+func (l jsonLogger) write(level string, err error, msg string) {
+    line := jsonLine{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: level, Message: strings.TrimRight(msg, "\n")}
+    if err != nil {
+        line.Error = redactString(err.Error())
+    }
+    encoded, _ := json.Marshal(line)
+    l.out.Write(append(encoded, '\n'))
+}
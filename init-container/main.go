@@ -6,9 +6,14 @@ import (
     "strings"
     "strconv"
     "context"
+    "time"
+    "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/config"
     "github.com/aws/aws-sdk-go-v2/aws/arn"
+    "github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+    "github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
     "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+    "github.com/aws/aws-sdk-go-v2/service/sts"
     "k8s.io/klog/v2"
     "encoding/json"
 )
@@ -18,13 +23,32 @@ type Secret struct {
     Id string
     Region string
     ExplodeJson bool
+    RoleArn string
+    ExternalId string
 }
 
+// SecretRole is the role to be assumed before retrieving a secret.
+type SecretRole struct {
+    RoleArn string `json:"roleArn"`
+    ExternalId string `json:"externalId"`
+}
+
+// assumedRoleCredentials caches the credentials for each assumed role, so that each role is only assumed once.
+var assumedRoleCredentials = map[SecretRole]aws.CredentialsProvider{}
+
 // main is the entry point for the init container.
 func main() {
+    if err := setupLogging(os.Getenv("LOG_FORMAT")); err != nil {
+        klog.Error(err)
+        os.Exit(1)
+    }
     envSecretArns := os.Getenv("SECRET_ARNS")
     envSecretNames :=  os.Getenv("SECRET_NAMES")
     envSecretRegion := os.Getenv("SECRET_REGION")
+    envCredentialMechanism := os.Getenv("CREDENTIAL_MECHANISM")
+    if envCredentialMechanism != "" {
+        klog.Info("Credential mechanism selected by the admission controller is ", envCredentialMechanism)
+    }
     envExplodeJsonKeys := false
     if os.Getenv("EXPLODE_JSON_KEYS") != "" {
         parsedEnvExplodeJsonKeys, err := strconv.ParseBool(os.Getenv("EXPLODE_JSON_KEYS"))
@@ -39,6 +63,7 @@ func main() {
     if envSecretArns != "" { 
         klog.Info("SECRET_ARNS env var is ", envSecretArns)
         for _, secretArn := range strings.Split(envSecretArns, ",") {
+            secretArn = strings.TrimSpace(secretArn)
             if !arn.IsARN(secretArn) {
                 klog.Error("Invalid ARN: ", secretArn)
                 os.Exit(2)
@@ -52,7 +77,16 @@ func main() {
         }
     } else if envSecretNames != "" {
         klog.Info("SECRET_NAMES env var is ", envSecretNames, " and SECRET_REGION is ", envSecretRegion)
+        if envSecretRegion == "" {
+            region, err := DetectRegion()
+            if err != nil {
+                klog.Error("SECRET_REGION env var is not set and the region could not be detected: ", err)
+                os.Exit(7)
+            }
+            envSecretRegion = region
+        }
         for _, name := range strings.Split(envSecretNames, ",") {
+            name = strings.TrimSpace(name)
             secrets = append(secrets, Secret{
                 Id: name,
                 Region: envSecretRegion,
@@ -64,6 +98,25 @@ func main() {
         os.Exit(3)
     }
 
+    // work out which role (if any) to assume for each secret
+    var secretRoles map[string]SecretRole
+    if os.Getenv("SECRET_ROLES") != "" {
+        err := json.Unmarshal([]byte(os.Getenv("SECRET_ROLES")), &secretRoles)
+        if err != nil {
+            klog.Error("SECRET_ROLES env var could not be parsed: ", err)
+            os.Exit(4)
+        }
+    }
+    for i := range secrets {
+        if role, ok := secretRoles[secrets[i].Id]; ok {
+            secrets[i].RoleArn = role.RoleArn
+            secrets[i].ExternalId = role.ExternalId
+        } else {
+            secrets[i].RoleArn = os.Getenv("ROLE_ARN")
+            secrets[i].ExternalId = os.Getenv("ROLE_EXTERNAL_ID")
+        }
+    }
+
     // process each secret
     for _, secret := range secrets {
         klog.Info("Processing: ", secret.Id)
@@ -84,6 +137,15 @@ func WriteSecretValue(secret Secret) error {
         klog.Info("Error while loading AWS configuration: ", err)
         os.Exit(5)
     }
+    if secret.RoleArn != "" {
+        cfg.Credentials = AssumeRole(cfg, SecretRole{RoleArn: secret.RoleArn, ExternalId: secret.ExternalId})
+    }
+    credentials, err := cfg.Credentials.Retrieve(ctx)
+    if err != nil {
+        klog.Error("Error while retrieving AWS credentials: ", err)
+        return err
+    }
+    klog.Info("Using AWS credentials from ", credentials.Source)
     client := secretsmanager.NewFromConfig(cfg)
     input := &secretsmanager.GetSecretValueInput{SecretId: &secret.Id}
     result, err := client.GetSecretValue(ctx, input)
@@ -102,6 +164,43 @@ func WriteSecretValue(secret Secret) error {
     }
 }
 
+// DetectRegion works out the AWS region from the AWS_REGION or AWS_DEFAULT_REGION env vars, or failing that
+// from the EC2 instance metadata service.
+func DetectRegion() (string, error) {
+    for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+        if region := os.Getenv(name); region != "" {
+            klog.Info("Using region ", region, " from ", name, " env var")
+            return region, nil
+        }
+    }
+    ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+    defer cancel()
+    result, err := imds.New(imds.Options{}).GetRegion(ctx, &imds.GetRegionInput{})
+    if err != nil {
+        return "", err
+    }
+    klog.Info("Using region ", result.Region, " from instance metadata")
+    return result.Region, nil
+}
+
+// AssumeRole returns a credentials provider for the given role, using the credentials in cfg to assume it.
+// Providers are cached per role, so the credentials are reused across secrets.
+func AssumeRole(cfg aws.Config, role SecretRole) aws.CredentialsProvider {
+    provider, ok := assumedRoleCredentials[role]
+    if ok {
+        return provider
+    }
+    klog.Info("Assuming role ", role.RoleArn)
+    provider = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+        o.RoleSessionName = "aws-secret-injector"
+        if role.ExternalId != "" {
+            o.ExternalID = aws.String(role.ExternalId)
+        }
+    }))
+    assumedRoleCredentials[role] = provider
+    return provider
+}
+
 // WriteJsonOutput writes a JSON string representing a map of key-value pairs to a set of files.
 // The files are named according to the keys.
 // Complex values are re-encoded as JSON.